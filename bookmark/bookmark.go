@@ -1,7 +1,10 @@
 package bookmark
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
+	"time"
 )
 
 type Bookmark struct {
@@ -12,7 +15,13 @@ type Bookmark struct {
 	Domain      string // Domain for favicon lookup
 	Tags        []string
 	Source      string
-	Icon        string // Path to cached favicon
+	Type        string    // Plugin type of the source, e.g. firefox for every Firefox instance
+	Sources     []string  // All sources of a bookmark merged by RemoveDuplicates
+	Profile     string    // Browser profile directory the bookmark was read from
+	Icon        string    // Path to cached favicon
+	Added       time.Time // When the bookmark was created in the browser, zero if unknown
+	Frecency    int       // The browser's own frecency score, zero if unknown
+	Keyword     string    // Shortcut typed instead of the URL; %s in the URI takes the rest
 }
 
 type Bookmarks []Bookmark
@@ -21,43 +30,36 @@ func (b Bookmarks) Len() int {
 	return len(b)
 }
 
-// RemoveDuplicates removes bookmarks with duplicate title and URI while merging their tags
+// RemoveDuplicates removes bookmarks with duplicate title and URI while
+// merging their tags and sources into the first one
 func (b Bookmarks) RemoveDuplicates() Bookmarks {
-	seen := make(map[string]*Bookmark)
+	seen := make(map[string]int)
 	var result Bookmarks
 
-	// Helper function to create unique key from title and URI
-	makeKey := func(bm Bookmark) string {
-		return bm.Title + "|" + bm.URI
-	}
-
-	// Helper function to merge tags without duplicates
-	mergeTags := func(existing []string, new []string) []string {
-		tagMap := make(map[string]bool)
-		for _, tag := range existing {
-			tagMap[tag] = true
-		}
-		for _, tag := range new {
-			tagMap[tag] = true
-		}
-
-		merged := make([]string, 0, len(tagMap))
-		for tag := range tagMap {
-			merged = append(merged, tag)
+	// Helper function to merge lists without duplicates, keeping their order
+	merge := func(existing []string, new []string) []string {
+		for _, item := range new {
+			if !contains(existing, item) {
+				existing = append(existing, item)
+			}
 		}
-		return merged
+		return existing
 	}
 
 	// Process all bookmarks
 	for _, bookmark := range b {
-		key := makeKey(bookmark)
-		if existing, exists := seen[key]; exists {
-			// Merge tags if this is a duplicate
-			existing.Tags = mergeTags(existing.Tags, bookmark.Tags)
+		key := bookmark.Title + "|" + bookmark.URI
+		if index, exists := seen[key]; exists {
+			// Merge tags and sources if this is a duplicate
+			existing := &result[index]
+			existing.Tags = merge(existing.Tags, bookmark.Tags)
+			existing.Sources = merge(existing.Sources, bookmark.AllSources())
 		} else {
 			// Create a copy of the bookmark to avoid modifying the original
 			bookmarkCopy := bookmark
-			seen[key] = &bookmarkCopy
+			bookmarkCopy.Tags = append([]string(nil), bookmark.Tags...)
+			bookmarkCopy.Sources = bookmark.AllSources()
+			seen[key] = len(result)
 			result = append(result, bookmarkCopy)
 		}
 	}
@@ -65,9 +67,38 @@ func (b Bookmarks) RemoveDuplicates() Bookmarks {
 	return result
 }
 
+// AllSources returns the sources of the bookmark, which are more than one
+// for merged duplicates
+func (b Bookmark) AllSources() []string {
+	if len(b.Sources) > 0 {
+		return append([]string(nil), b.Sources...)
+	}
+	if b.Source == "" {
+		return nil
+	}
+	return []string{b.Source}
+}
+
+// ID returns a short identifier derived from the source, profile and URI
+// of the bookmark. It stays the same when the bookmark is renamed, moved
+// to another folder or tagged.
+func (b Bookmark) ID() string {
+	sum := sha256.Sum256([]byte(b.Source + "\x00" + b.Profile + "\x00" + b.URI))
+	return hex.EncodeToString(sum[:6])
+}
+
+func contains(list []string, item string) bool {
+	for _, s := range list {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
 // URLIsValid checks whether the bookmark's URI is reachable.
 func (b Bookmark) URLIsValid() bool {
-	httpClient := new(http.Client)
+	httpClient := &http.Client{Timeout: 10 * time.Second}
 	resp, err := httpClient.Head(b.URI)
 	if err != nil {
 		return false
@@ -0,0 +1,39 @@
+package bookmark
+
+import "testing"
+
+func TestID(t *testing.T) {
+	// The example of the README
+	bm := Bookmark{
+		Title:   "marks repo",
+		URI:     "https://github.com/zwo-bot/marks",
+		Path:    "toolbar/Work/Infra",
+		Tags:    []string{"go"},
+		Source:  "Firefox",
+		Profile: "/home/me/.mozilla/firefox/abc.default-release",
+	}
+	const want = "6b2f2ceb523f"
+	if got := bm.ID(); got != want {
+		t.Fatalf("ID() = %q, want %q", got, want)
+	}
+
+	edited := bm
+	edited.Title = "marks"
+	edited.Path = "toolbar"
+	edited.Tags = []string{"go", "tools"}
+	edited.Description = "Bookmark manager"
+	edited.Sources = []string{"Firefox", "Chrome"}
+	if got := edited.ID(); got != want {
+		t.Errorf("ID() of the renamed, moved and tagged bookmark = %q, want %q", got, want)
+	}
+
+	for name, other := range map[string]Bookmark{
+		"source":  {Source: "Chrome", Profile: bm.Profile, URI: bm.URI},
+		"profile": {Source: bm.Source, Profile: "/home/me/.mozilla/firefox/xyz.work", URI: bm.URI},
+		"url":     {Source: bm.Source, Profile: bm.Profile, URI: bm.URI + "/"},
+	} {
+		if got := other.ID(); got == want {
+			t.Errorf("ID() with another %s = %q, the same as the original", name, got)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/db"
+	"github.com/zwo-bot/marks/internal/api"
+	"github.com/zwo-bot/marks/internal/config"
+	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/internal/opener"
+	"github.com/zwo-bot/marks/internal/query"
+)
+
+// apiServer answers the daemon's API requests. It keeps the cached
+// bookmarks and usage scores in memory, so that lists don't need to read
+// every row and favicon from the database.
+type apiServer struct {
+	mu        sync.Mutex
+	bookmarks bookmark.Bookmarks
+	scores    map[string]float64
+	// changes tells when other processes wrote to the database, e.g. by
+	// deleting a bookmark or recording an open; nil if it isn't available
+	changes *db.ChangeWatcher
+}
+
+// reload reads the bookmarks and usage scores from the database
+func (s *apiServer) reload() {
+	log := logger.GetLogger()
+
+	bookmarks, err := db.GetBookmarks()
+	if err != nil {
+		log.Error("Error reading bookmarks for the API", "error", err)
+		return
+	}
+	scores, err := db.FrecencyScores(frecencyHalfLife())
+	if err != nil {
+		log.Error("Error reading bookmark usage for the API", "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bookmarks, s.scores = bookmarks, scores
+	log.Debug("Loaded bookmarks for the API", "count", len(bookmarks))
+}
+
+// reloadIfChanged reloads the bookmarks if the database changed since
+// they were read
+func (s *apiServer) reloadIfChanged() {
+	if s.changes == nil {
+		return
+	}
+	changed, err := s.changes.Changed()
+	if err != nil {
+		logger.GetLogger().Error("Error checking the database for changes", "error", err)
+		return
+	}
+	if changed {
+		logger.GetLogger().Debug("Database changed, reloading bookmarks for the API")
+		s.reload()
+	}
+}
+
+// reloadScores reads the usage scores after a bookmark was opened
+func (s *apiServer) reloadScores() {
+	scores, err := db.FrecencyScores(frecencyHalfLife())
+	if err != nil {
+		logger.GetLogger().Error("Error reading bookmark usage for the API", "error", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scores = scores
+}
+
+func (s *apiServer) handle(req api.Request) api.Response {
+	logger.GetLogger().Debug("API request", "method", req.Method, "query", req.Query, "url", req.URL)
+
+	switch req.Method {
+	case api.MethodList:
+		bookmarks, err := s.list(req)
+		if err != nil {
+			return api.Response{Error: err.Error()}
+		}
+		return api.Response{Bookmarks: api.NewBookmarks(bookmarks)}
+	case api.MethodSearch:
+		q, err := query.Parse(req.Query)
+		if err != nil {
+			return api.Response{Error: err.Error()}
+		}
+		// Checking links would keep the client waiting beyond its timeout
+		if err := q.CheckOffline(); err != nil {
+			return api.Response{Error: err.Error()}
+		}
+		bookmarks, err := db.QueryBookmarks(q, req.Limit)
+		if err != nil {
+			return api.Response{Error: err.Error()}
+		}
+		return api.Response{Bookmarks: api.NewBookmarks(bookmarks)}
+	case api.MethodOpen:
+		if req.URL == "" {
+			return api.Response{Error: "missing url"}
+		}
+		argv, err := opener.Command(s.lookup(req.URL), opener.Options{Private: req.Private, NewWindow: req.NewWindow})
+		if err != nil {
+			return api.Response{Error: err.Error()}
+		}
+		if err := db.RecordOpen(req.URL); err != nil {
+			return api.Response{Error: err.Error()}
+		}
+		s.reloadScores()
+		return api.Response{Command: argv}
+	case api.MethodRecordUsage:
+		if req.URL == "" {
+			return api.Response{Error: "missing url"}
+		}
+		if err := db.RecordOpen(req.URL); err != nil {
+			return api.Response{Error: err.Error()}
+		}
+		s.reloadScores()
+		return api.Response{}
+	}
+	return api.Response{Error: "unknown method " + req.Method}
+}
+
+// lookup returns the bookmark of uri, or a bookmark with just the URI if it
+// is not a known bookmark
+func (s *apiServer) lookup(uri string) bookmark.Bookmark {
+	s.reloadIfChanged()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, bm := range s.bookmarks {
+		if bm.URI == uri {
+			return bm
+		}
+	}
+	return bookmark.Bookmark{URI: uri, Title: uri}
+}
+
+// list filters the bookmarks in memory and orders them like rofi does
+func (s *apiServer) list(req api.Request) (bookmark.Bookmarks, error) {
+	q, err := query.Parse(req.Query)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.CheckOffline(); err != nil {
+		return nil, err
+	}
+
+	s.reloadIfChanged()
+	s.mu.Lock()
+	all, scores := s.bookmarks, s.scores
+	s.mu.Unlock()
+	if all == nil {
+		return nil, errors.New("bookmarks are not loaded")
+	}
+
+	// Filter returns the same slice for an empty query; sorting must not
+	// reorder the cached bookmarks
+	bookmarks := append(bookmark.Bookmarks(nil), q.Filter(all)...)
+	if req.Deduplicate {
+		bookmarks = bookmarks.RemoveDuplicates()
+	}
+	db.SortByScores(bookmarks, scores, config.GlobalConfig.Frecency.BrowserFallback)
+	if req.Limit > 0 && len(bookmarks) > req.Limit {
+		bookmarks = bookmarks[:req.Limit]
+	}
+	return bookmarks, nil
+}
+
+// requestBookmarks asks the daemon for bookmarks. It returns false if no
+// daemon answered, so that the caller reads the database instead.
+func requestBookmarks(req api.Request) (bookmark.Bookmarks, bool) {
+	log := logger.GetLogger()
+
+	resp, err := api.Call(req)
+	if errors.Is(err, api.ErrNoServer) {
+		log.Debug("No daemon, reading the database", "error", err)
+		return nil, false
+	}
+	if err != nil {
+		log.Error("Error asking the daemon, reading the database", "method", req.Method, "error", err)
+		return nil, false
+	}
+	return api.ToBookmarks(resp.Bookmarks), true
+}
+
+// recordUsage counts an open of uri for the ranking. A running daemon
+// records it, so that its next list has it; otherwise it is written to the
+// database here.
+func recordUsage(uri string) {
+	log := logger.GetLogger()
+
+	_, err := api.Call(api.Request{Method: api.MethodRecordUsage, URL: uri})
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, api.ErrNoServer) {
+		log.Error("Error recording bookmark usage through the daemon", "error", err)
+		return
+	}
+	connectDatabase()
+	if err := db.RecordOpen(uri); err != nil {
+		log.Error("Error recording bookmark usage", "error", err)
+	}
+}
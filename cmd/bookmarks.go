@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/db"
+	"github.com/zwo-bot/marks/internal/config"
+	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/internal/query"
+	"github.com/zwo-bot/marks/plugins"
+)
+
+// queryString returns the --query flag of cmd, or the configured default
+// when the flag was not given
+func queryString(cmd *cobra.Command, flagValue string, configDefault string) string {
+	return flagOrConfig(cmd, "query", flagValue, configDefault)
+}
+
+// flagOrConfig returns the value of the named flag if it was given on the
+// command line, otherwise the configured default
+func flagOrConfig(cmd *cobra.Command, name string, flagValue string, configDefault string) string {
+	if cmd.Flags().Changed(name) {
+		return flagValue
+	}
+	return configDefault
+}
+
+// loadBookmarks returns the bookmarks matching q. They come from the
+// database for a fast response; when it can't be read or is still empty,
+// they are read from the plugins directly. Failed queries are returned.
+func loadBookmarks(q *query.Query) (bookmark.Bookmarks, error) {
+	log := logger.GetLogger()
+
+	count, err := db.CountBookmarks()
+	if err != nil {
+		log.Error("Error getting bookmarks from database", "error", err)
+		// If we can't get from DB, try getting directly from plugins
+		return q.Filter(pluginBookmarks()), nil
+	}
+
+	if count == 0 {
+		// If DB is empty, fill it from the plugins, unless an update is
+		// already doing so
+		log.Debug("No bookmarks in database, getting from plugins")
+		unlock, err := db.LockUpdate(false)
+		if err != nil {
+			log.Debug("Not saving initial bookmarks", "error", err)
+			return q.Filter(pluginBookmarks()), nil
+		}
+		updatePlugins(context.Background(), plugins.Init(), true, plugins.DefaultTimeout)
+		unlock()
+	}
+
+	return db.QueryBookmarks(q, 0)
+}
+
+// pluginBookmarks reads the bookmarks of all plugins, without those of the
+// plugins that fail
+func pluginBookmarks() bookmark.Bookmarks {
+	bookmarks, err := plugins.Init().GetBookmarks(context.Background())
+	if err != nil {
+		logger.GetLogger().Error("Error getting bookmarks from plugins", "error", err)
+	}
+	return bookmarks
+}
+
+// rankBookmarks orders bookmarks by frecency, keeping the current order if
+// the usage history can't be read
+func rankBookmarks(bookmarks bookmark.Bookmarks) {
+	cfg := config.GlobalConfig.Frecency
+	if err := db.SortByFrecency(bookmarks, frecencyHalfLife(), cfg.BrowserFallback); err != nil {
+		logger.GetLogger().Error("Error ranking bookmarks", "error", err)
+	}
+}
+
+// frecencyHalfLife returns the configured half-life of usage scores
+func frecencyHalfLife() time.Duration {
+	return time.Duration(config.GlobalConfig.Frecency.HalfLifeDays * float64(24*time.Hour))
+}
+
+// spawnUpdate starts the update command as a separate process so that the
+// cache is refreshed for the next call without delaying this one
+func spawnUpdate() {
+	log := logger.GetLogger()
+
+	if db.DaemonRunning() {
+		log.Debug("The daemon keeps the cache current, not starting an update")
+		return
+	}
+
+	// A running update already refreshes the cache
+	args := []string{"update", "--skip-if-running"}
+
+	// Pass config path if it was specified
+	if rootOptions.configPath != "" {
+		args = append(args, "--config", rootOptions.configPath)
+	}
+
+	// Pass log level to maintain consistent logging
+	args = append(args, "--log-level", rootOptions.logLevel)
+
+	if rootOptions.logFilePath != "" {
+		args = append(args, "--log-file", rootOptions.logFilePath)
+	}
+
+	if rootOptions.dbPath != "" {
+		args = append(args, "--db", db.Path())
+	}
+
+	updateCmd := exec.Command(os.Args[0], args...)
+
+	// Inherit the parent process's environment
+	updateCmd.Env = os.Environ()
+
+	// Start the command without waiting for it to complete
+	if err := updateCmd.Start(); err != nil {
+		log.Error("Error starting update process", "error", err)
+	} else {
+		log.Debug("Started update process", "pid", updateCmd.Process.Pid)
+		// Don't wait for the process to complete since we want it to run in background
+		go func() {
+			if err := updateCmd.Wait(); err != nil {
+				log.Error("Update process failed", "error", err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zwo-bot/marks/db"
+	"github.com/zwo-bot/marks/internal/api"
+	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/internal/watch"
+	"github.com/zwo-bot/marks/plugins"
+	"github.com/zwo-bot/marks/plugins/interfaces"
+)
+
+var (
+	daemonDebounce time.Duration
+	daemonSystemd  bool
+	daemonCmd      = &cobra.Command{
+		Use:   "daemon",
+		Short: "Keep the bookmarks database current",
+		Long: `Watch the files browsers keep their bookmarks in and update the database
+when they change. While the daemon runs, rofi, show and pick don't start
+updates of their own.
+
+The daemon also answers rofi and search through a Unix socket in
+$XDG_RUNTIME_DIR, so that they don't need to open the database. Each
+database has its own daemon and socket; marks doctor shows the socket.
+
+To run the daemon with your session as a systemd user service:
+
+  marks daemon --systemd > ~/.config/systemd/user/marks.service
+  systemctl --user enable --now marks.service`,
+		Run: runDaemonCmd,
+	}
+)
+
+func init() {
+	daemonCmd.Flags().DurationVar(&daemonDebounce, "debounce", 2*time.Second, "Time a browser's files must be unchanged before its bookmarks are read")
+	daemonCmd.Flags().BoolVar(&daemonSystemd, "systemd", false, "Print a systemd user unit running the daemon instead of running it")
+	rootCmd.AddCommand(daemonCmd)
+}
+
+func runDaemonCmd(cmd *cobra.Command, args []string) {
+	log := logger.GetLogger()
+
+	if daemonSystemd {
+		if err := writeSystemdUnit(os.Stdout); err != nil {
+			log.Error("Error writing systemd unit", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := runDaemon(ctx); err != nil {
+		log.Error("Error running daemon", "error", err)
+		os.Exit(1)
+	}
+}
+
+// runDaemon updates plugins whose files changed until ctx is done
+func runDaemon(ctx context.Context) error {
+	log := logger.GetLogger()
+
+	unlock, err := db.LockDaemon()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	watcher, err := watch.New()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	p := plugins.Init()
+	owners := make(map[string]interfaces.Plugin)
+	for _, plugin := range p {
+		var paths []string
+		if w, ok := plugin.(interfaces.Watcher); ok {
+			if paths, err = w.WatchPaths(); err != nil {
+				log.Error("Error getting files to watch", "plugin", plugin.GetName(), "error", err)
+				continue
+			}
+		}
+		if len(paths) == 0 {
+			log.Warn("Plugin has no files to watch, its bookmarks are only read on start", "plugin", plugin.GetName())
+			continue
+		}
+		for _, path := range paths {
+			if err := watcher.Add(path); err != nil {
+				log.Error("Error watching file", "plugin", plugin.GetName(), "error", err)
+				continue
+			}
+			owners[filepath.Clean(path)] = plugin
+			log.Debug("Watching file", "plugin", plugin.GetName(), "path", path)
+		}
+	}
+
+	// Catch up with changes made while the daemon wasn't running
+	refreshPlugins(ctx, p)
+	if unlock, err := db.LockUpdate(true); err == nil {
+		removeDisabledSources()
+		unlock()
+	}
+
+	server := &apiServer{}
+	if changes, err := db.WatchChanges(); err != nil {
+		log.Warn("Can't watch the database, lists miss changes made by other commands until the next update", "error", err)
+	} else {
+		defer changes.Close()
+		server.changes = changes
+	}
+	server.reload()
+
+	changes := make(chan string)
+	failed := make(chan error, 2)
+	go func() {
+		failed <- watcher.Run(changes)
+	}()
+	go func() {
+		failed <- api.Serve(ctx, api.SocketPath(), server.handle)
+	}()
+
+	// A plugin is updated once its files haven't changed for the debounce
+	// time, as browsers write them in several steps
+	refresh := make(chan interfaces.Plugin)
+	timers := make(map[string]*time.Timer)
+	log.Info("Daemon started", "files", len(owners))
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Daemon stopped")
+			return nil
+		case err := <-failed:
+			return err
+		case path := <-changes:
+			plugin := owners[path]
+			if timer, ok := timers[plugin.GetName()]; ok {
+				timer.Reset(daemonDebounce)
+				continue
+			}
+			timers[plugin.GetName()] = time.AfterFunc(daemonDebounce, func() {
+				select {
+				case refresh <- plugin:
+				case <-ctx.Done():
+				}
+			})
+		case plugin := <-refresh:
+			if refreshPlugins(ctx, plugins.Plugins{plugin}) {
+				server.reload()
+			}
+		}
+	}
+}
+
+// refreshPlugins updates the bookmarks of the plugins once no other update
+// runs and reports whether any changed. Plugins whose bookmarks didn't
+// change, e.g. because only the history was written, are skipped by their
+// fingerprint.
+func refreshPlugins(ctx context.Context, p plugins.Plugins) bool {
+	unlock, err := db.LockUpdate(true)
+	if err != nil {
+		logger.GetLogger().Error("Error locking the database for the update", "plugins", p.ListPlugins(), "error", err)
+		return false
+	}
+	defer unlock()
+
+	changed := false
+	for _, r := range updatePlugins(ctx, p, false, plugins.DefaultTimeout) {
+		if r.err == nil && r.summary.Changed() {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// writeSystemdUnit writes a systemd user unit that runs the daemon with
+// the current configuration and log options
+func writeSystemdUnit(w io.Writer) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not find the marks executable: %v", err)
+	}
+	args := []string{executable, "daemon", "--debounce", daemonDebounce.String(), "--log-level", rootOptions.logLevel}
+	if rootOptions.configPath != "" {
+		configPath, err := filepath.Abs(rootOptions.configPath)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--config", configPath)
+	}
+	if rootOptions.logFilePath != "" {
+		logFilePath, err := filepath.Abs(rootOptions.logFilePath)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--log-file", logFilePath)
+	}
+	if rootOptions.dbPath != "" {
+		args = append(args, "--db", db.Path())
+	}
+
+	_, err = fmt.Fprintf(w, `[Unit]
+Description=Keep the marks bookmark cache current
+
+[Service]
+Type=simple
+ExecStart=%s
+Restart=on-failure
+
+[Install]
+WantedBy=default.target
+`, systemdCommandLine(args))
+	return err
+}
+
+// systemdCommandLine joins args for ExecStart, quoting those that need it
+func systemdCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = systemdQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// systemdQuote escapes specifiers and variables in s and quotes it if
+// systemd would split it
+func systemdQuote(s string) string {
+	s = strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	return strconv.Quote(s)
+}
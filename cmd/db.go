@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/zwo-bot/marks/db"
+	"github.com/zwo-bot/marks/internal/logger"
+)
+
+var (
+	dbMigrateStatus bool
+	dbCmd           = &cobra.Command{
+		Use:   "db",
+		Short: "Manage the bookmarks database",
+	}
+	dbMigrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate the database to the current schema",
+		Long: `Apply pending schema migrations to the database. Other commands do this
+when they open the database; --status shows the migrations without
+applying them.`,
+		Args: cobra.NoArgs,
+		Run:  runDBMigrate,
+		// Opens the database without migrating it
+		Annotations: map[string]string{lazyDatabase: "true"},
+	}
+)
+
+func init() {
+	dbMigrateCmd.Flags().BoolVar(&dbMigrateStatus, "status", false, "List the migrations and whether they were applied")
+	dbCmd.AddCommand(dbMigrateCmd)
+	rootCmd.AddCommand(dbCmd)
+}
+
+func runDBMigrate(cmd *cobra.Command, args []string) {
+	log := logger.GetLogger()
+
+	if err := db.OpenDatabase(); err != nil {
+		log.Error("Error opening database", "error", err)
+		os.Exit(1)
+	}
+
+	if dbMigrateStatus {
+		if err := printMigrationStatus(); err != nil {
+			log.Error("Error reading migration status", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	applied, err := db.Migrate()
+	if err != nil {
+		log.Error("Error migrating database", "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Applied %d migrations, %s is at schema version %d\n", applied, db.Path(), db.SchemaVersion())
+}
+
+// printMigrationStatus lists the migrations with the time they were applied
+func printMigrationStatus() error {
+	states, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	version, err := db.DatabaseVersion()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Database: %s\n", db.Path())
+	fmt.Printf("Schema version: %d (this marks: %d)\n\n", version, db.SchemaVersion())
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, s := range states {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		name := s.Name
+		if s.Unknown {
+			name += " (from a newer marks)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, name, applied)
+	}
+	return w.Flush()
+}
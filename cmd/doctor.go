@@ -0,0 +1,426 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zwo-bot/marks/db"
+	"github.com/zwo-bot/marks/internal/api"
+	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/plugins"
+	"github.com/zwo-bot/marks/plugins/external"
+	"github.com/zwo-bot/marks/plugins/interfaces"
+)
+
+var (
+	doctorJSON    bool
+	doctorTimeout time.Duration
+	doctorCmd     = &cobra.Command{
+		Use:   "doctor",
+		Short: "Check why bookmarks might be missing",
+		Long: `Check the plugins, the database, the favicon cache and the daemon, and
+report problems that keep bookmarks from showing up. Every plugin reads
+its bookmarks once, also without a usable database. Nothing is written:
+the database is opened read-only and no icons are cached.
+Exits with status 1 if there are problems; warnings don't change the exit
+status.`,
+		Args: cobra.NoArgs,
+		Run:  runDoctor,
+		// Opens the database read-only, without creating or migrating it
+		Annotations: map[string]string{lazyDatabase: "true"},
+	}
+)
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorJSON, "json", false, "Print the report as JSON")
+	doctorCmd.Flags().DurationVar(&doctorTimeout, "timeout", plugins.DefaultTimeout, "How long to wait for each plugin's bookmarks")
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// doctorReport is the result of marks doctor
+type doctorReport struct {
+	Plugins  []pluginCheck `json:"plugins"`
+	Database databaseCheck `json:"database"`
+	Favicons faviconCheck  `json:"favicons"`
+	Daemon   daemonCheck   `json:"daemon"`
+	// Problems are not tied to one plugin, e.g. invalid configurations
+	Problems []string `json:"problems,omitempty"`
+	OK       bool     `json:"ok"`
+}
+
+// pluginCheck describes a plugin instance
+type pluginCheck struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Source   string `json:"source"`
+	Priority int    `json:"priority"`
+	// Executable is set for external plugins
+	Executable string `json:"executable,omitempty"`
+	interfaces.Diagnosis
+	// Bookmarks is the number of bookmarks read, -1 if reading failed
+	Bookmarks int           `json:"bookmarks"`
+	Duration  time.Duration `json:"duration_ns"`
+	// Cached is the number of bookmarks of the source in the database
+	Cached      int64      `json:"cached"`
+	LastUpdate  *time.Time `json:"last_update,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// databaseCheck describes the bookmark cache
+type databaseCheck struct {
+	Path   string `json:"path"`
+	Exists bool   `json:"exists"`
+	// Size includes the write-ahead log
+	Size          int64    `json:"size"`
+	Version       int      `json:"schema_version"`
+	SchemaVersion int      `json:"supported_schema_version"`
+	Bookmarks     int64    `json:"bookmarks"`
+	Problems      []string `json:"problems,omitempty"`
+	Warnings      []string `json:"warnings,omitempty"`
+}
+
+// faviconCheck describes the favicon cache
+type faviconCheck struct {
+	db.FaviconState
+	Problems []string `json:"problems,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// daemonCheck tells whether the daemon answers on its socket
+type daemonCheck struct {
+	Running  bool     `json:"running"`
+	Socket   string   `json:"socket"`
+	Answers  bool     `json:"answers"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+func runDoctor(cmd *cobra.Command, args []string) {
+	log := logger.GetLogger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db.SetReadOnly()
+
+	var report doctorReport
+	report.Database, report.Favicons = checkDatabase()
+	report.Daemon = checkDaemon()
+
+	p, errs := plugins.Setup()
+	for _, err := range errs {
+		report.Problems = append(report.Problems, err.Error())
+	}
+	report.Plugins = checkPlugins(ctx, p, report.Database)
+
+	report.OK = countProblems(report) == 0
+
+	var err error
+	if doctorJSON {
+		err = printDoctorJSON(os.Stdout, report)
+	} else {
+		err = printDoctorReport(os.Stdout, report)
+	}
+	if err != nil {
+		log.Error("Error printing the report", "error", err)
+		os.Exit(1)
+	}
+	if !report.OK {
+		os.Exit(1)
+	}
+}
+
+// checkDatabase checks the bookmark cache and, if it can be read, the
+// favicon cache
+func checkDatabase() (databaseCheck, faviconCheck) {
+	check := databaseCheck{Path: db.Path(), SchemaVersion: db.SchemaVersion()}
+	var favicons faviconCheck
+
+	info, err := os.Stat(check.Path)
+	if err != nil {
+		check.Warnings = append(check.Warnings, "there is no database yet, run marks update")
+		return check, favicons
+	}
+	check.Exists = true
+	check.Size = info.Size()
+	if wal, err := os.Stat(check.Path + "-wal"); err == nil {
+		check.Size += wal.Size()
+	}
+
+	if err := db.OpenDatabase(); err != nil {
+		check.Problems = append(check.Problems, fmt.Sprintf("can't open the database: %v", err))
+		return check, favicons
+	}
+	if check.Version, err = db.DatabaseVersion(); err != nil {
+		check.Problems = append(check.Problems, fmt.Sprintf("can't read the schema version: %v", err))
+		return check, favicons
+	}
+	switch {
+	case check.Version > check.SchemaVersion:
+		check.Problems = append(check.Problems, "the database was written by a newer marks, please update marks")
+		return check, favicons
+	case check.Version < check.SchemaVersion:
+		check.Warnings = append(check.Warnings, "the database needs migrating, run marks db migrate")
+		return check, favicons
+	}
+
+	if check.Bookmarks, err = db.CountBookmarks(); err != nil {
+		check.Problems = append(check.Problems, fmt.Sprintf("can't count bookmarks: %v", err))
+	} else if check.Bookmarks == 0 {
+		check.Warnings = append(check.Warnings, "the database has no bookmarks, run marks update")
+	}
+
+	if favicons.FaviconState, err = db.FaviconStatus(); err != nil {
+		favicons.Warnings = append(favicons.Warnings, fmt.Sprintf("can't read the favicon cache: %v", err))
+	} else if favicons.Stored > 0 && favicons.Files == 0 {
+		favicons.Warnings = append(favicons.Warnings, "the favicon cache directory is empty, icons are written again by the next update")
+	}
+	return check, favicons
+}
+
+// checkDaemon tells whether the daemon runs and answers
+func checkDaemon() daemonCheck {
+	check := daemonCheck{Running: db.DaemonRunning(), Socket: api.SocketPath()}
+	if _, err := api.Call(api.Request{Method: api.MethodList, Limit: 1}); err == nil {
+		check.Answers = true
+	}
+	if check.Running && !check.Answers {
+		check.Warnings = append(check.Warnings, "the daemon runs but doesn't answer on its socket")
+	}
+	return check
+}
+
+// checkPlugins diagnoses every plugin and reads its bookmarks
+func checkPlugins(ctx context.Context, p plugins.Plugins, database databaseCheck) []pluginCheck {
+	log := logger.GetLogger()
+
+	// The cache can only be compared if it has the current schema
+	var counts map[string]int64
+	states := make(map[string]db.SourceState)
+	if database.Exists && database.Version == database.SchemaVersion {
+		var err error
+		if counts, err = db.CountBookmarksBySource(); err != nil {
+			log.Error("Error counting cached bookmarks", "error", err)
+		}
+		list, err := db.SourceStates()
+		if err != nil {
+			log.Error("Error reading source states", "error", err)
+		}
+		for _, s := range list {
+			states[s.Source] = s
+		}
+	}
+
+	results := p.Fetch(ctx, doctorTimeout)
+	checks := make([]pluginCheck, 0, len(p))
+	for i, plugin := range p {
+		check := pluginCheck{Name: plugin.GetName(), Source: plugin.GetName(), Bookmarks: -1}
+		var inner interfaces.Plugin = plugin
+		if instance, ok := plugin.(*plugins.Instance); ok {
+			check.Name, check.Type, check.Priority = instance.Name, instance.Type, instance.Priority
+			inner = instance.Unwrap()
+		}
+		if ext, ok := inner.(*external.ExternalPlugin); ok {
+			check.Executable = ext.Path
+		}
+		check.Favicons = -1
+		if d, ok := inner.(interfaces.Diagnoser); ok {
+			check.Diagnosis = d.Diagnose(ctx)
+		}
+
+		result := results[i]
+		check.Duration = result.Duration
+		if result.Err != nil {
+			check.Problems = append(check.Problems, fmt.Sprintf("can't read bookmarks: %v", result.Err))
+		} else {
+			check.Bookmarks = len(result.Bookmarks)
+			if check.Bookmarks == 0 {
+				check.Warnings = append(check.Warnings, "the plugin has no bookmarks")
+			}
+		}
+
+		check.Cached = counts[check.Source]
+		if state, ok := states[check.Source]; ok {
+			if !state.UpdatedAt.IsZero() {
+				check.LastUpdate = &state.UpdatedAt
+			}
+			check.LastError, check.LastErrorAt = state.LastError, state.LastErrorAt
+		}
+		if check.LastError != "" {
+			check.Warnings = append(check.Warnings, "the last update failed, the cache has the bookmarks of the update before")
+		}
+		if database.Exists && check.Cached == 0 && check.Bookmarks > 0 {
+			check.Warnings = append(check.Warnings, "no bookmarks of this plugin are cached, run marks update")
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// countProblems returns the number of problems in the report
+func countProblems(report doctorReport) int {
+	count := len(report.Problems) + len(report.Database.Problems) + len(report.Favicons.Problems)
+	for _, p := range report.Plugins {
+		count += len(p.Problems)
+	}
+	return count
+}
+
+// countWarnings returns the number of warnings in the report
+func countWarnings(report doctorReport) int {
+	count := len(report.Database.Warnings) + len(report.Favicons.Warnings) + len(report.Daemon.Warnings)
+	for _, p := range report.Plugins {
+		count += len(p.Warnings)
+	}
+	return count
+}
+
+func printDoctorJSON(out io.Writer, report doctorReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
+
+// printDoctorReport prints the report for people
+func printDoctorReport(out io.Writer, report doctorReport) error {
+	w := &doctorWriter{out: out}
+
+	w.heading("Database")
+	d := report.Database
+	if d.Exists {
+		w.line("path", "%s (%s)", d.Path, formatSize(d.Size))
+		w.line("schema version", "%d (this marks: %d)", d.Version, d.SchemaVersion)
+		if d.Version == d.SchemaVersion {
+			w.line("bookmarks", "%d", d.Bookmarks)
+		}
+	} else {
+		w.line("path", "%s (missing)", d.Path)
+	}
+	w.issues(d.Problems, d.Warnings)
+
+	w.heading("Favicons")
+	f := report.Favicons
+	if f.Dir != "" {
+		w.line("cache", "%s, %d files, %s", f.Dir, f.Files, formatSize(f.Size))
+		w.line("stored", "%d, bookmarks without icon: %d", f.Stored, f.Missing)
+	} else {
+		w.line("cache", "not checked")
+	}
+	w.issues(f.Problems, f.Warnings)
+
+	w.heading("Daemon")
+	switch {
+	case report.Daemon.Answers:
+		w.line("status", "running, answering on %s", report.Daemon.Socket)
+	case report.Daemon.Running:
+		w.line("status", "running, no answer on %s", report.Daemon.Socket)
+	default:
+		w.line("status", "not running")
+	}
+	w.issues(nil, report.Daemon.Warnings)
+
+	w.heading("Plugins")
+	w.issues(report.Problems, nil)
+	for _, p := range report.Plugins {
+		w.plugin(p)
+	}
+
+	fmt.Fprintf(w.out, "\n%d problems, %d warnings\n", countProblems(report), countWarnings(report))
+	return w.err
+}
+
+// doctorWriter prints the sections of the report and keeps the first
+// write error
+type doctorWriter struct {
+	out io.Writer
+	err error
+	// indent is printed before lines and issues
+	indent string
+}
+
+func (w *doctorWriter) printf(format string, args ...interface{}) {
+	if w.err == nil {
+		_, w.err = fmt.Fprintf(w.out, format, args...)
+	}
+}
+
+func (w *doctorWriter) heading(title string) {
+	w.printf("%s\n", title)
+}
+
+func (w *doctorWriter) line(label string, format string, args ...interface{}) {
+	w.printf("%s  %-16s %s\n", w.indent, label+":", fmt.Sprintf(format, args...))
+}
+
+func (w *doctorWriter) issues(problems []string, warnings []string) {
+	for _, p := range problems {
+		w.printf("%s  problem: %s\n", w.indent, p)
+	}
+	for _, warning := range warnings {
+		w.printf("%s  warning: %s\n", w.indent, warning)
+	}
+}
+
+func (w *doctorWriter) plugin(p pluginCheck) {
+	w.printf("  %s (%s, type %s, priority %d)\n", p.Source, p.Name, p.Type, p.Priority)
+	w.indent = "  "
+	defer func() { w.indent = "" }()
+
+	if p.Executable != "" {
+		w.line("executable", "%s", p.Executable)
+	}
+	if p.Profile != "" {
+		w.line("profile", "%s", p.Profile)
+	}
+	for _, f := range p.Files {
+		if f.Readable {
+			w.line("file", "%s, readable", f.Path)
+		} else {
+			w.line("file", "%s, not readable: %s", f.Path, f.Error)
+		}
+	}
+	if p.Schema != "" {
+		w.line("schema", "%s", p.Schema)
+	}
+	if p.Bookmarks >= 0 {
+		w.line("bookmarks", "%d read in %s, %d cached", p.Bookmarks, p.Duration.Round(time.Millisecond), p.Cached)
+	} else {
+		w.line("bookmarks", "%d cached", p.Cached)
+	}
+	if p.Favicons >= 0 {
+		w.line("favicons", "%d", p.Favicons)
+	}
+	if p.LastUpdate != nil {
+		w.line("last update", "%s", p.LastUpdate.Local().Format("2006-01-02 15:04:05"))
+	}
+	if p.LastErrorAt != nil {
+		w.line("last error", "%s: %s", p.LastErrorAt.Local().Format("2006-01-02 15:04:05"), p.LastError)
+	} else if p.LastError != "" {
+		w.line("last error", "%s", p.LastError)
+	}
+	w.issues(p.Problems, p.Warnings)
+}
+
+// formatSize formats a size in bytes for people
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, exp := float64(size)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[exp])
+}
@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/db"
+	"github.com/zwo-bot/marks/internal/api"
+	"github.com/zwo-bot/marks/internal/config"
+	"github.com/zwo-bot/marks/internal/export"
+	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/internal/opener"
+	"github.com/zwo-bot/marks/internal/query"
+)
+
+var (
+	openOptions  opener.Options
+	openSource   string
+	openList     bool
+	openPrint    bool
+	openLauncher string
+	openCmd      = &cobra.Command{
+		Use:   "open <url|keyword|query...>",
+		Short: "Open a bookmark",
+		Long: `Open a URL, a keyword or the best matching bookmark.
+
+A URL is opened in the browser and profile its bookmark was read from,
+falling back to the configured default browser and then to xdg-open.
+A keyword of a Firefox bookmark or from the configuration expands to its
+URL, with %s replaced by the remaining arguments: 'marks open ddg go generics'.
+Anything else is searched like 'marks search'. The best match is opened
+when it clearly wins, otherwise a launcher shows the candidates.`,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeBookmarkTitles,
+		Run:               openBookmarkCmd,
+	}
+)
+
+func init() {
+	openCmd.Flags().BoolVarP(&openOptions.Private, "private", "p", false, "Open in a private window")
+	openCmd.Flags().BoolVarP(&openOptions.NewWindow, "new-window", "w", false, "Open in a new window")
+	openCmd.Flags().StringVarP(&openSource, "source", "s", "", "Only consider bookmarks from this browser, e.g. firefox")
+	openCmd.Flags().BoolVar(&openList, "list", false, "List the matching bookmarks instead of opening one")
+	openCmd.Flags().BoolVar(&openPrint, "print", false, "Print the URL instead of opening it")
+	openCmd.Flags().StringVar(&openLauncher, "launcher", "", "Launcher asking for the bookmark when there is no clear match")
+	rootCmd.AddCommand(openCmd)
+}
+
+func openBookmarkCmd(cmd *cobra.Command, args []string) {
+	log := logger.GetLogger()
+
+	bm, err := resolveOpen(cmd, args)
+	if err != nil {
+		log.Error("Error opening bookmark", "args", args, "error", err)
+		os.Exit(1)
+	}
+	if bm == nil {
+		// Listed, or the user cancelled the launcher
+		return
+	}
+
+	if openPrint {
+		fmt.Println(bm.URI)
+		return
+	}
+	if err := openBookmark(*bm, openOptions); err != nil {
+		log.Error("Error opening bookmark", "uri", bm.URI, "error", err)
+		os.Exit(1)
+	}
+}
+
+// resolveOpen finds the bookmark to open for the arguments of open. It
+// returns nil if there is nothing to open.
+func resolveOpen(cmd *cobra.Command, args []string) (*bookmark.Bookmark, error) {
+	if len(args) == 1 && strings.Contains(args[0], "://") {
+		bm := lookupURI(args[0])
+		return &bm, nil
+	}
+	if bm := expandKeyword(args); bm != nil {
+		return bm, nil
+	}
+
+	text := strings.Join(args, " ")
+	if openSource != "" {
+		text += fmt.Sprintf(` source:"%s"`, openSource)
+	}
+	q, err := query.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.CheckOffline(); err != nil {
+		return nil, err
+	}
+
+	candidates, err := loadBookmarks(q)
+	if err != nil {
+		return nil, err
+	}
+	candidates = candidates.RemoveDuplicates()
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no bookmark matches %q", strings.Join(args, " "))
+	}
+	rankBookmarks(candidates)
+	if openList {
+		return nil, export.Write(os.Stdout, "text", candidates, export.Options{})
+	}
+
+	if bm := bestMatch(candidates, strings.Join(args, " ")); bm != nil {
+		return bm, nil
+	}
+
+	cfg := config.GlobalConfig.Pick
+	picker, err := newBookmarkPicker(flagOrConfig(cmd, "launcher", openLauncher, cfg.Launcher), cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+	return picker.choose(candidates)
+}
+
+// expandKeyword returns the bookmark for a keyword in the first argument
+// with %s in its URL replaced by the other arguments, or nil if the first
+// argument is no keyword. Like in Firefox, %S inserts them unescaped.
+func expandKeyword(args []string) *bookmark.Bookmark {
+	keyword, terms := args[0], strings.Join(args[1:], " ")
+
+	var bm *bookmark.Bookmark
+	if template, ok := config.GlobalConfig.Keywords[keyword]; ok {
+		bm = &bookmark.Bookmark{Title: keyword, URI: template}
+	} else if found, err := db.GetBookmarkByKeyword(keyword); err == nil {
+		bm = found
+	} else {
+		return nil
+	}
+
+	escaped := strings.ReplaceAll(url.QueryEscape(terms), "+", "%20")
+	bm.URI = strings.NewReplacer("%s", escaped, "%S", terms).Replace(bm.URI)
+	return bm
+}
+
+// bestMatch returns the candidate that clearly wins: the only one, the
+// only one whose title is the search text, or one opened at least twice as
+// often as any other. It returns nil if there is no such candidate.
+func bestMatch(candidates bookmark.Bookmarks, text string) *bookmark.Bookmark {
+	if len(candidates) == 1 {
+		return &candidates[0]
+	}
+
+	var exact *bookmark.Bookmark
+	for i, bm := range candidates {
+		if strings.EqualFold(strings.TrimSpace(bm.Title), strings.TrimSpace(text)) {
+			if exact != nil {
+				exact = nil
+				break
+			}
+			exact = &candidates[i]
+		}
+	}
+	if exact != nil {
+		return exact
+	}
+
+	scores, err := db.FrecencyScores(frecencyHalfLife())
+	if err != nil {
+		logger.GetLogger().Error("Error reading bookmark usage", "error", err)
+		return nil
+	}
+	best, top, second := -1, 0.0, 0.0
+	for i, bm := range candidates {
+		switch score := scores[bm.URI]; {
+		case score > top:
+			best, top, second = i, score, top
+		case score > second:
+			second = score
+		}
+	}
+	if best >= 0 && top >= 2*second {
+		return &candidates[best]
+	}
+	return nil
+}
+
+// completeBookmarkTitles suggests the titles of bookmarks matching the
+// word being completed, and keywords
+func completeBookmarkTitles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	// Completions don't run the root command's hooks
+	connectDatabase()
+
+	var suggestions []string
+	for keyword, template := range config.GlobalConfig.Keywords {
+		if strings.HasPrefix(keyword, toComplete) {
+			suggestions = append(suggestions, keyword+"\t"+template)
+		}
+	}
+	if keywords, err := db.GetKeywordBookmarks(toComplete); err == nil {
+		for _, bm := range keywords {
+			suggestions = append(suggestions, bm.Keyword+"\t"+bm.Title)
+		}
+	}
+
+	q, err := query.Parse(toComplete)
+	if err == nil {
+		err = q.CheckOffline()
+	}
+	if err != nil {
+		return suggestions, cobra.ShellCompDirectiveNoFileComp
+	}
+	bookmarks, err := db.QueryBookmarks(q, 50)
+	if err != nil {
+		return suggestions, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	seen := make(map[string]bool)
+	for _, bm := range bookmarks {
+		if bm.Title == "" || seen[bm.Title] {
+			continue
+		}
+		seen[bm.Title] = true
+		suggestions = append(suggestions, bm.Title+"\t"+bm.URI)
+	}
+	return suggestions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// lookupURI returns the cached bookmark for uri, or a bookmark with just
+// the URI if it is not a known bookmark
+func lookupURI(uri string) bookmark.Bookmark {
+	bm, err := db.GetBookmarkByURI(uri)
+	if err != nil {
+		logger.GetLogger().Debug("Bookmark not in cache, using URI only", "uri", uri, "error", err)
+		return bookmark.Bookmark{URI: uri, Title: uri}
+	}
+	return *bm
+}
+
+// openURI opens the cached bookmark for uri, or the bare URI if it is not
+// a known bookmark. A running daemon finds the bookmark and records the
+// open; the browser is started here either way.
+func openURI(uri string, opts opener.Options) error {
+	resp, err := api.Call(api.Request{Method: api.MethodOpen, URL: uri, Private: opts.Private, NewWindow: opts.NewWindow})
+	if err == nil {
+		logger.GetLogger().Debug("Opening bookmark", "uri", uri, "command", resp.Command)
+		return opener.Start(resp.Command)
+	}
+	if !errors.Is(err, api.ErrNoServer) {
+		logger.GetLogger().Error("Error opening through the daemon, reading the database", "error", err)
+	}
+	connectDatabase()
+	return openBookmark(lookupURI(uri), opts)
+}
+
+// openBookmark records the open for frecency ranking and launches bm
+func openBookmark(bm bookmark.Bookmark, opts opener.Options) error {
+	recordUsage(bm.URI)
+	return opener.Open(bm, opts)
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/internal/config"
+	"github.com/zwo-bot/marks/internal/launcher"
+	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/internal/opener"
+	"github.com/zwo-bot/marks/internal/query"
+	"github.com/zwo-bot/marks/internal/render"
+)
+
+// defaultPickTemplate is the text shown per bookmark; launchers other than
+// rofi's script mode don't render markup
+const defaultPickTemplate = "{{ or .Title .Path }}  ·  {{ domain .URI }}"
+
+var (
+	pickLauncher    string
+	pickQuery       string
+	pickTemplate    string
+	pickDeduplicate bool
+	pickOptions     opener.Options
+	pickCmd         = &cobra.Command{
+		Use:   "pick",
+		Short: "Pick a bookmark with a launcher and open it",
+		Long: `Show bookmarks in a launcher such as dmenu, rofi, fuzzel, wofi, tofi,
+walker or fzf and open the selected one like marks rofi does.
+Without --launcher an installed launcher suited to the session is used.`,
+		Run: pickBookmark,
+	}
+)
+
+func init() {
+	pickCmd.Flags().StringVar(&pickLauncher, "launcher", "", "Launcher to use ("+strings.Join(launcher.Names(), "|")+")")
+	pickCmd.Flags().StringVarP(&pickQuery, "query", "q", "", `Filter bookmarks, e.g. 'tag:go -tag:old source:firefox folder:Work added:<30d "exact phrase"'`)
+	pickCmd.Flags().StringVarP(&pickTemplate, "template", "t", "", "Go text/template for the shown text, e.g. '{{ .Title }} ({{ join \", \" .Tags }})'")
+	pickCmd.Flags().BoolVarP(&pickDeduplicate, "deduplicate", "d", true, "Remove duplicate bookmarks")
+	pickCmd.Flags().BoolVarP(&pickOptions.Private, "private", "p", false, "Open in a private window")
+	pickCmd.Flags().BoolVarP(&pickOptions.NewWindow, "new-window", "w", false, "Open in a new window")
+	rootCmd.AddCommand(pickCmd)
+}
+
+func pickBookmark(cmd *cobra.Command, args []string) {
+	if err := runPick(cmd); err != nil {
+		logger.GetLogger().Error("Error picking bookmark", "error", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runPick(cmd *cobra.Command) error {
+	cfg := config.GlobalConfig.Pick
+
+	picker, err := newBookmarkPicker(
+		flagOrConfig(cmd, "launcher", pickLauncher, cfg.Launcher),
+		flagOrConfig(cmd, "template", pickTemplate, cfg.Template))
+	if err != nil {
+		return err
+	}
+
+	q, err := query.Parse(queryString(cmd, pickQuery, cfg.Query))
+	if err != nil {
+		return err
+	}
+	if err := q.CheckOffline(); err != nil {
+		return err
+	}
+
+	bookmarks, err := loadBookmarks(q)
+	if err != nil {
+		return err
+	}
+	if pickDeduplicate {
+		bookmarks = bookmarks.RemoveDuplicates()
+	}
+	rankBookmarks(bookmarks)
+
+	// Refresh the cache while the user is picking
+	spawnUpdate()
+
+	selected, err := picker.choose(bookmarks)
+	if err != nil || selected == nil {
+		return err
+	}
+	return openBookmark(*selected, pickOptions)
+}
+
+// bookmarkPicker shows bookmarks in a launcher
+type bookmarkPicker struct {
+	launcher launcher.Launcher
+	tmpl     *render.Template
+}
+
+// newBookmarkPicker looks up the launcher, detecting an installed one if
+// name is empty, and compiles the label template or the default one
+func newBookmarkPicker(name string, templateText string) (*bookmarkPicker, error) {
+	if name == "" {
+		detected, err := launcher.Detect()
+		if err != nil {
+			return nil, err
+		}
+		name = detected
+	}
+	l, err := launcher.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := render.Parse("pick", orDefault(templateText, defaultPickTemplate))
+	if err != nil {
+		return nil, err
+	}
+	return &bookmarkPicker{launcher: l, tmpl: tmpl}, nil
+}
+
+// choose returns the bookmark selected in the launcher, or nil if the user
+// cancelled
+func (p *bookmarkPicker) choose(bookmarks bookmark.Bookmarks) (*bookmark.Bookmark, error) {
+	labels := make([]string, len(bookmarks))
+	for i, bm := range bookmarks {
+		var err error
+		if labels[i], err = p.tmpl.Line(bm); err != nil {
+			return nil, err
+		}
+	}
+	return launcher.Pick(p.launcher, "Bookmarks", bookmarks, labels)
+}
@@ -3,61 +3,145 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"os/exec"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
-	"github.com/zwo-bot/marks/db"
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/internal/api"
+	"github.com/zwo-bot/marks/internal/config"
 	"github.com/zwo-bot/marks/internal/logger"
-	"github.com/zwo-bot/marks/plugins"
+	"github.com/zwo-bot/marks/internal/opener"
+	"github.com/zwo-bot/marks/internal/query"
+	"github.com/zwo-bot/marks/internal/render"
+)
+
+const (
+	// defaultRofiTemplate shows the title in bold followed by the URL
+	defaultRofiTemplate = `<b>{{ or .Title .Path | pango }}</b>  <span color='#888888' alpha='70%'>{{ .URI | pango }}</span>`
+	// defaultRofiMetaTemplate lets rofi match the URL
+	defaultRofiMetaTemplate = `{{ .URI }}`
+)
+
+var (
+	// The compiled templates for rofiRow
+	rofiDisplayTemplate = render.Must("rofi", defaultRofiTemplate)
+	rofiMetaTemplate    = render.Must("rofi meta", defaultRofiMetaTemplate)
 )
 
 var (
 	rofiDeduplicate bool
+	rofiQuery       string
+	rofiMulti       bool
+	rofiNewWindow   bool
+	rofiMode        string
+	rofiTemplate    string
+	rofiMeta        string
 	rofiCmd         = &cobra.Command{
 		Use:   "rofi",
 		Short: "Show bookmarks in rofi format",
 		Long:  `Show bookmarks in rofi format and handle rofi interactions.`,
 		Run:   showRofiBookmarks,
+		// Lists come from the daemon when it runs
+		Annotations: map[string]string{lazyDatabase: "true"},
 	}
 )
 
 func init() {
 	rofiCmd.Flags().BoolVarP(&rofiDeduplicate, "deduplicate", "d", true, "Remove duplicate bookmarks")
+	rofiCmd.Flags().StringVarP(&rofiQuery, "query", "q", "", `Filter bookmarks, e.g. 'tag:go -tag:old source:firefox folder:Work added:<30d "exact phrase"'`)
+	rofiCmd.Flags().BoolVarP(&rofiMulti, "multi-select", "m", false, "Run rofi in dmenu mode and open all selected bookmarks")
+	rofiCmd.Flags().BoolVarP(&rofiNewWindow, "new-window", "w", false, "Open multi-selected bookmarks in a new window")
+	rofiCmd.Flags().StringVar(&rofiMode, "mode", "list", "Rofi view: list (all bookmarks), folders (browse the folder tree) or tags (browse by tag)")
+	rofiCmd.Flags().StringVar(&rofiTemplate, "template", "", "Go text/template for the displayed row, e.g. '<b>{{ .Title | pango }}</b> {{ domain .URI }}'")
+	rofiCmd.Flags().StringVar(&rofiMeta, "meta-template", "", "Go text/template for the hidden text rofi matches against, e.g. '{{ .URI }} {{ join \" \" .Tags }}'")
 	rootCmd.AddCommand(rofiCmd)
 }
 
 func showRofiBookmarks(cmd *cobra.Command, args []string) {
 	log := logger.GetLogger()
 
-	// Check if rofi has selected an item
-	if os.Getenv("ROFI_RETV") == "1" {
-		// Get the selected URL from ROFI_INFO
-		url := os.Getenv("ROFI_INFO")
-		if url != "" {
-			// Open URL in default browser using xdg-open
-			openCmd := exec.Command("xdg-open", url)
-			openCmd.Start()
+	if err := loadRofiTemplates(cmd); err != nil {
+		log.Error("Invalid template", "error", err)
+		fmt.Println("\x00message\x1f" + escapePango(err.Error()))
+		return
+	}
+
+	// Check if rofi has selected an item or pressed a custom key
+	retv, _ := strconv.Atoi(os.Getenv("ROFI_RETV"))
+	info := os.Getenv("ROFI_INFO")
+	// The current folder or tag selection of the folders and tags modes
+	data := os.Getenv("ROFI_DATA")
+	switch {
+	case retv == 1 && strings.HasPrefix(info, rofiFolderCommand):
+		data = strings.TrimPrefix(info, rofiFolderCommand)
+	case retv == 1 && strings.HasPrefix(info, rofiTagsCommand):
+		data = strings.TrimPrefix(info, rofiTagsCommand)
+	case retv == 1 && strings.HasPrefix(info, rofiCommandPrefix):
+		connectDatabase()
+		if runRofiCommand(info) {
 			return
 		}
+	case retv == 1 && info != "":
+		// Open in the browser and profile the bookmark came from
+		if err := openURI(info, opener.Options{}); err != nil {
+			log.Error("Error opening bookmark", "uri", info, "error", err)
+		}
+		return
+	case retv >= rofiCustomBase && retv < rofiCustomBase+19:
+		custom := retv - rofiCustomBase + 1
+		if rofiAction(custom) == "reset" {
+			data = ""
+		} else {
+			connectDatabase()
+			if runRofiAction(custom, info) {
+				return
+			}
+		}
 	}
 
-	// First get bookmarks from DB for fast response
-	bookmarks, err := db.GetBookmarks()
+	text := queryString(cmd, rofiQuery, config.GlobalConfig.Rofi.Query)
+	q, err := query.Parse(text)
+	if err == nil {
+		err = q.CheckOffline()
+	}
 	if err != nil {
-		log.Error("Error getting bookmarks from database", "error", err)
-		// If we can't get from DB, try getting directly from plugins
-		p := plugins.Init()
-		bookmarks = p.GetBookmarks()
-	} else if len(bookmarks) == 0 {
-		// If DB is empty, get from plugins
-		log.Debug("No bookmarks in database, getting from plugins")
-		p := plugins.Init()
-		bookmarks = p.GetBookmarks()
-		// Save to DB for next time
-		if err := db.UpdateBookmarks(bookmarks); err != nil {
-			log.Error("Error saving initial bookmarks to database", "error", err)
+		log.Error("Invalid query", "error", err)
+		// Show the problem in rofi's message bar instead of an empty list
+		fmt.Println("\x00message\x1fInvalid query: " + escapePango(err.Error()))
+		return
+	}
+
+	bookmarks, served := requestBookmarks(api.Request{Method: api.MethodList, Query: text, Deduplicate: rofiDeduplicate})
+	if !served {
+		connectDatabase()
+		bookmarks, err = loadBookmarks(q)
+		if err != nil {
+			log.Error("Error querying bookmarks in database", "error", err)
+			fmt.Println("\x00message\x1fCan't read bookmarks: " + escapePango(err.Error()))
+			return
+		}
+
+		// Deduplicate if requested
+		if rofiDeduplicate {
+			bookmarks = bookmarks.RemoveDuplicates()
+		}
+
+		// Most used bookmarks first
+		rankBookmarks(bookmarks)
+	}
+
+	if rofiMulti {
+		connectDatabase()
+
+		// Refresh the cache while the user is selecting
+		spawnUpdate()
+
+		newWindow := rofiNewWindow || config.GlobalConfig.Rofi.MultiSelect.NewWindow
+		if err := runRofiMultiSelect(bookmarks, newWindow); err != nil {
+			log.Error("Error in multi-select", "error", err)
 		}
+		return
 	}
 
 	// Enable markup parsing
@@ -66,83 +150,92 @@ func showRofiBookmarks(cmd *cobra.Command, args []string) {
 	// Set custom prompt
 	fmt.Println("\x00prompt\x1f ")
 
-		// Deduplicate if requested
-	if rofiDeduplicate {
-		bookmarks = bookmarks.RemoveDuplicates()
+	// Enable kb-custom-N keys and list them in the message line
+	fmt.Println("\x00use-hot-keys\x1ftrue")
+	fmt.Println("\x00message\x1f" + rofiMessage())
+
+	switch rofiMode {
+	case "folders":
+		printRofiFolder(bookmarks, data)
+	case "tags":
+		printRofiTags(bookmarks, data)
+	default:
+		// Output bookmarks in rofi format
+		for _, bookmark := range bookmarks {
+			fmt.Println(rofiRow(bookmark))
+		}
 	}
 
-	// Output bookmarks in rofi format
-	for _, bookmark := range bookmarks {
-			// Create display text with Pango markup
-			title := bookmark.Title
-			if title == "" {
-				title = bookmark.Path
-			}
-			
-			// Escape Pango markup characters in title and URL
-			title = strings.ReplaceAll(title, "&", "&amp;")
-			title = strings.ReplaceAll(title, "<", "&lt;")
-			title = strings.ReplaceAll(title, ">", "&gt;")
-			url := strings.ReplaceAll(bookmark.URI, "&", "&amp;")
-			url = strings.ReplaceAll(url, "<", "&lt;")
-			url = strings.ReplaceAll(url, ">", "&gt;")
-			
-			// Build single line display with title and URL
-			displayText := fmt.Sprintf("<b>%s</b>  <span color='#888888' alpha='70%%'>%s</span>", title, url)
-
-			// Build the line in rofi format with the multi-line display text
-			line := displayText + "\x00info\x1f" + bookmark.URI
-			
-			// Add icon if available
-			if bookmark.Icon != "" {
-				log.Debug("Adding icon to rofi output", 
-					"title", bookmark.Title,
-					"path", bookmark.Path,
-					"icon_path", bookmark.Icon)
-				line += "\x1ficon\x1f" + bookmark.Icon
-			} else {
-				log.Debug("No icon available for bookmark",
-					"title", bookmark.Title,
-					"path", bookmark.Path,
-					"uri", bookmark.URI)
-			}
-			
-			// Add meta field
-			line += "\x1fmeta\x1f" + bookmark.URI
+	// Refresh the cache in the background for the next call
+	spawnUpdate()
+}
 
-			fmt.Println(line)
-		}
+// loadRofiTemplates compiles the row and meta templates from the flags,
+// the config or the defaults
+func loadRofiTemplates(cmd *cobra.Command) error {
+	cfg := config.GlobalConfig.Rofi
+
+	display, err := render.Parse("rofi", orDefault(flagOrConfig(cmd, "template", rofiTemplate, cfg.Template), defaultRofiTemplate))
+	if err != nil {
+		return err
+	}
+	meta, err := render.Parse("rofi meta", orDefault(flagOrConfig(cmd, "meta-template", rofiMeta, cfg.MetaTemplate), defaultRofiMetaTemplate))
+	if err != nil {
+		return err
+	}
+
+	rofiDisplayTemplate, rofiMetaTemplate = display, meta
+	return nil
+}
 
-	// Spawn the update command as a separate process
-	args = []string{"update"}
-	
-	// Pass config path if it was specified
-	if rootOptions.configPath != "" {
-		args = append(args, "--config", rootOptions.configPath)
+func orDefault(value string, def string) string {
+	if value == "" {
+		return def
 	}
-	
-	// Pass log level to maintain consistent logging
-	args = append(args, "--log-level", rootOptions.logLevel)
+	return value
+}
+
+// rofiRow formats a bookmark as a rofi row: the display text followed by
+// the URI as info, the icon and the meta field used for matching
+func rofiRow(bookmark bookmark.Bookmark) string {
+	log := logger.GetLogger()
 
-	if rootOptions.logFilePath != "" {
-		args = append(args, "--log-file", rootOptions.logFilePath)
+	displayText, err := rofiDisplayTemplate.Line(bookmark)
+	if err != nil {
+		log.Error("Error rendering rofi template", "uri", bookmark.URI, "error", err)
+		displayText = escapePango(bookmark.URI)
 	}
 
-	updateCmd := exec.Command(os.Args[0], args...)
-	
-	// Inherit the parent process's environment
-	updateCmd.Env = os.Environ()
-	
-	// Start the command without waiting for it to complete
-	if err := updateCmd.Start(); err != nil {
-		log.Error("Error starting update process", "error", err)
+	// Build the line in rofi format with the display text
+	line := displayText + "\x00info\x1f" + bookmark.URI
+
+	// Add icon if available
+	if bookmark.Icon != "" {
+		log.Debug("Adding icon to rofi output",
+			"title", bookmark.Title,
+			"path", bookmark.Path,
+			"icon_path", bookmark.Icon)
+		line += "\x1ficon\x1f" + bookmark.Icon
 	} else {
-		log.Debug("Started update process", "pid", updateCmd.Process.Pid)
-		// Don't wait for the process to complete since we want it to run in background
-		go func() {
-			if err := updateCmd.Wait(); err != nil {
-				log.Error("Update process failed", "error", err)
-			}
-		}()
+		log.Debug("No icon available for bookmark",
+			"title", bookmark.Title,
+			"path", bookmark.Path,
+			"uri", bookmark.URI)
 	}
+
+	// Add meta field; the separators of rofi's row options can't be part
+	// of it
+	meta, err := rofiMetaTemplate.Line(bookmark)
+	if err != nil {
+		log.Error("Error rendering rofi meta template", "uri", bookmark.URI, "error", err)
+		meta = bookmark.URI
+	}
+	line += "\x1fmeta\x1f" + strings.NewReplacer("\x00", "", "\x1f", "").Replace(meta)
+
+	return line
+}
+
+// escapePango escapes text for use in rofi's Pango markup
+func escapePango(text string) string {
+	return render.Pango(text)
 }
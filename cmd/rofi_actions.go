@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/db"
+	"github.com/zwo-bot/marks/internal/clipboard"
+	"github.com/zwo-bot/marks/internal/config"
+	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/internal/opener"
+	"github.com/zwo-bot/marks/plugins"
+	"github.com/zwo-bot/marks/plugins/interfaces"
+)
+
+// rofiCustomBase is the ROFI_RETV value of kb-custom-1; kb-custom-N
+// returns rofiCustomBase+N-1 up to kb-custom-19
+const rofiCustomBase = 10
+
+// defaultRofiKeybindings are used when none are configured
+var defaultRofiKeybindings = []config.RofiKeybinding{
+	{Custom: 1, Action: "copy-url"},
+	{Custom: 2, Action: "copy-markdown"},
+	{Custom: 3, Action: "open-private"},
+	{Custom: 4, Action: "details"},
+	{Custom: 5, Action: "delete"},
+	{Custom: 6, Action: "open-folder"},
+	{Custom: 7, Action: "reset"},
+}
+
+// rofiActionLabels describes the actions in rofi's message line
+var rofiActionLabels = map[string]string{
+	"copy-url":      "copy URL",
+	"copy-markdown": "copy Markdown",
+	"open-private":  "private window",
+	"details":       "details",
+	"delete":        "delete",
+	"open-folder":   "open folder",
+	"reset":         "back to top",
+}
+
+func rofiKeybindings() []config.RofiKeybinding {
+	if len(config.GlobalConfig.Rofi.Keybindings) > 0 {
+		return config.GlobalConfig.Rofi.Keybindings
+	}
+	return defaultRofiKeybindings
+}
+
+// rofiKeyLabel returns the key shown for a binding, which defaults to the
+// key rofi assigns to kb-custom-N out of the box
+func rofiKeyLabel(kb config.RofiKeybinding) string {
+	switch {
+	case kb.Key != "":
+		return kb.Key
+	case kb.Custom >= 1 && kb.Custom <= 9:
+		return fmt.Sprintf("Alt+%d", kb.Custom)
+	case kb.Custom == 10:
+		return "Alt+0"
+	default:
+		return fmt.Sprintf("kb-custom-%d", kb.Custom)
+	}
+}
+
+// rofiMessage lists the active keybindings for rofi's message line
+func rofiMessage() string {
+	var parts []string
+	for _, kb := range rofiKeybindings() {
+		label, ok := rofiActionLabels[kb.Action]
+		if !ok {
+			label = kb.Action
+			command, found := strings.CutPrefix(kb.Action, "open-with:")
+			if fields := strings.Fields(command); found && len(fields) > 0 {
+				label = "open in " + filepath.Base(fields[0])
+			}
+		}
+		parts = append(parts, fmt.Sprintf("<b>%s</b> %s", escapePango(rofiKeyLabel(kb)), escapePango(label)))
+	}
+	return strings.Join(parts, "  ·  ")
+}
+
+// rofiAction returns the action bound to kb-custom-N, if any
+func rofiAction(custom int) string {
+	for _, kb := range rofiKeybindings() {
+		if kb.Custom == custom {
+			return kb.Action
+		}
+	}
+	return ""
+}
+
+// runRofiAction runs the action bound to kb-custom-N on the bookmark with
+// the given URI. It reports whether the action produced rofi's output, so
+// that the bookmark list should not be printed.
+func runRofiAction(custom int, uri string) bool {
+	log := logger.GetLogger()
+
+	action := rofiAction(custom)
+	if action == "" || uri == "" {
+		log.Debug("No rofi action for key", "custom", custom, "uri", uri)
+		return false
+	}
+
+	// Folder rows only support opening the whole folder
+	if folder, ok := strings.CutPrefix(uri, rofiFolderCommand); ok {
+		return action == "open-folder" && rofiOpenFolder(folder, false)
+	}
+	if strings.HasPrefix(uri, rofiCommandPrefix) {
+		return false
+	}
+
+	bm, err := db.GetBookmarkByURI(uri)
+	if err != nil {
+		log.Debug("Bookmark not in cache, using URI only", "uri", uri, "error", err)
+		bm = &bookmark.Bookmark{URI: uri, Title: uri}
+	}
+
+	log.Debug("Running rofi action", "action", action, "uri", uri)
+	switch {
+	case action == "copy-url":
+		err = clipboard.Copy(bm.URI)
+	case action == "copy-markdown":
+		err = clipboard.Copy(fmt.Sprintf("[%s](%s)", strings.ReplaceAll(bm.Title, "]", "\\]"), bm.URI))
+	case action == "open-private":
+		err = openBookmark(*bm, opener.Options{Private: true})
+	case strings.HasPrefix(action, "open-with:"):
+		err = openWith(strings.TrimPrefix(action, "open-with:"), bm.URI)
+	case action == "open-folder":
+		return rofiOpenFolder(bm.Path, false)
+	case action == "details":
+		printRofiDetails(*bm)
+		return true
+	case action == "delete":
+		if err := db.DeleteBookmark(bm.URI); err != nil {
+			log.Error("Error deleting bookmark", "uri", bm.URI, "error", err)
+		}
+		deleteAtSource(*bm)
+		// Show the list again without the deleted bookmark
+		return false
+	default:
+		log.Error("Unknown rofi action", "action", action)
+		return false
+	}
+
+	if err != nil {
+		log.Error("Rofi action failed", "action", action, "error", err)
+	}
+	// Print nothing so that rofi closes
+	return true
+}
+
+// deleteAtSource deletes bm in the plugin it came from, if that plugin can
+// delete bookmarks. Other bookmarks are only hidden in marks.
+func deleteAtSource(bm bookmark.Bookmark) {
+	log := logger.GetLogger()
+
+	for _, plugin := range plugins.Init() {
+		deleter, ok := plugin.(interfaces.Deleter)
+		if !ok || plugin.GetName() != bm.Source {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), plugins.DefaultTimeout)
+		err := deleter.DeleteBookmark(ctx, bm)
+		cancel()
+		if errors.Is(err, errors.ErrUnsupported) {
+			log.Debug("Plugin can't delete bookmarks", "plugin", bm.Source)
+		} else if err != nil {
+			log.Error("Error deleting bookmark at its source", "plugin", bm.Source, "uri", bm.URI, "error", err)
+		}
+		return
+	}
+}
+
+// openWith opens uri with a command line; the URI is appended as the last
+// argument
+func openWith(command string, uri string) error {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return fmt.Errorf("empty command")
+	}
+
+	recordUsage(uri)
+	return exec.Command(fields[0], append(fields[1:], uri)...).Start()
+}
+
+// printRofiDetails shows all fields of a bookmark as a rofi list. Selecting
+// a field opens the bookmark, selecting Back returns to the list.
+func printRofiDetails(bm bookmark.Bookmark) {
+	fmt.Println("\x00markup-rows\x1ftrue")
+	fmt.Println("\x00use-hot-keys\x1ftrue")
+	fmt.Println("\x00prompt\x1fDetails")
+	rofiKeepData()
+	fmt.Println("\x00message\x1f" + rofiMessage())
+
+	added := ""
+	if !bm.Added.IsZero() {
+		added = bm.Added.Local().Format("2006-01-02 15:04")
+	}
+
+	// The back entry has no info, so selecting it shows the list again
+	fmt.Println("<i>« Back</i>")
+	rows := [][2]string{
+		{"Title", bm.Title},
+		{"URL", bm.URI},
+		{"Path", bm.Path},
+		{"Tags", strings.Join(bm.Tags, ", ")},
+		{"Source", bm.Source},
+		{"Added", added},
+		{"Description", bm.Description},
+	}
+	for _, row := range rows {
+		if row[1] == "" {
+			continue
+		}
+		fmt.Printf("<b>%s</b>  %s\x00info\x1f%s\n", row[0], escapePango(row[1]), bm.URI)
+	}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/zwo-bot/marks/bookmark"
+)
+
+// rofiFolderCommand prefixes ROFI_INFO values that navigate to a folder
+const rofiFolderCommand = rofiCommandPrefix + "folder:"
+
+// folderParts splits a bookmark path into its folder names
+func folderParts(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// printRofiFolder lists the subfolders and bookmarks of one folder. The
+// folder is kept in ROFI_DATA so that rofi passes it back on the next call.
+func printRofiFolder(bookmarks bookmark.Bookmarks, folder string) {
+	folder = strings.Trim(folder, "/")
+	current := folderParts(folder)
+
+	counts := make(map[string]int)
+	var direct bookmark.Bookmarks
+	for _, bm := range bookmarks {
+		parts := folderParts(bm.Path)
+		if len(parts) < len(current) || strings.Join(parts[:len(current)], "/") != folder {
+			continue
+		}
+		if rest := parts[len(current):]; len(rest) > 0 {
+			counts[rest[0]]++
+		} else {
+			direct = append(direct, bm)
+		}
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+
+	fmt.Println("\x00data\x1f" + folder)
+	fmt.Println("\x00prompt\x1f/" + folder)
+
+	if len(current) > 0 {
+		parent := path.Dir(folder)
+		if parent == "." {
+			parent = ""
+		}
+		fmt.Println("..\x00info\x1f" + rofiFolderCommand + parent + "\x1ficon\x1fgo-up")
+	}
+
+	for _, name := range names {
+		child := strings.TrimPrefix(folder+"/"+name, "/")
+		fmt.Printf("<b>%s</b>  <span alpha='70%%'>%d</span>\x00info\x1f%s\x1ficon\x1ffolder\x1fmeta\x1f%s\n",
+			escapePango(name), counts[name], rofiFolderCommand+child, child)
+	}
+
+	for _, bm := range direct {
+		fmt.Println(rofiRow(bm))
+	}
+}
+
+// rofiKeepData passes ROFI_DATA on to the next call, for views that replace
+// the list but should return to the same place
+func rofiKeepData() {
+	if data := os.Getenv("ROFI_DATA"); data != "" {
+		fmt.Println("\x00data\x1f" + data)
+	}
+}
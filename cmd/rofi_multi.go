@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/db"
+	"github.com/zwo-bot/marks/internal/config"
+	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/internal/opener"
+)
+
+// rofiCommandPrefix marks ROFI_INFO values that are commands for marks
+// rather than bookmark URIs
+const rofiCommandPrefix = "marks:"
+
+const (
+	defaultMultiSelectMax     = 20
+	defaultMultiSelectConfirm = 5
+)
+
+// multiSelectLimits returns the configured cap and confirmation threshold
+func multiSelectLimits() (max int, confirmAbove int) {
+	cfg := config.GlobalConfig.Rofi.MultiSelect
+	max, confirmAbove = cfg.Max, cfg.ConfirmAbove
+	if max <= 0 {
+		max = defaultMultiSelectMax
+	}
+	if confirmAbove <= 0 {
+		confirmAbove = defaultMultiSelectConfirm
+	}
+	return max, confirmAbove
+}
+
+// openBookmarks opens several bookmarks. With newWindow, the bookmarks of
+// each browser profile open together in a new window.
+func openBookmarks(bookmarks bookmark.Bookmarks, newWindow bool) {
+	log := logger.GetLogger()
+	for _, bm := range bookmarks {
+		recordUsage(bm.URI)
+	}
+	if err := opener.OpenAll(bookmarks, opener.Options{NewWindow: newWindow}); err != nil {
+		log.Error("Error opening bookmarks", "error", err)
+	}
+}
+
+// runRofiMultiSelect runs rofi in dmenu mode with -multi-select and opens
+// every selected bookmark
+func runRofiMultiSelect(bookmarks bookmark.Bookmarks, newWindow bool) error {
+	log := logger.GetLogger()
+
+	var input bytes.Buffer
+	for _, bm := range bookmarks {
+		input.WriteString(rofiRow(bm) + "\n")
+	}
+
+	// -format i prints the indices of the selected rows, one per line
+	rofi := exec.Command("rofi", "-dmenu", "-multi-select", "-i",
+		"-markup-rows", "-show-icons", "-format", "i", "-p", "Bookmarks",
+		"-mesg", "<b>Shift+Enter</b> select  ·  <b>Enter</b> open selected")
+	rofi.Stdin = &input
+	rofi.Stderr = os.Stderr
+	output, err := rofi.Output()
+	if err != nil {
+		// rofi exits with status 1 when cancelled
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return nil
+		}
+		return fmt.Errorf("error running rofi: %v", err)
+	}
+
+	var selected bookmark.Bookmarks
+	for _, field := range strings.Fields(string(output)) {
+		index, err := strconv.Atoi(field)
+		if err != nil || index < 0 || index >= len(bookmarks) {
+			log.Debug("Ignoring invalid rofi selection", "value", field)
+			continue
+		}
+		selected = append(selected, bookmarks[index])
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+
+	max, confirmAbove := multiSelectLimits()
+	total := len(selected)
+	if total > max {
+		selected = selected[:max]
+	}
+	if total > max || len(selected) > confirmAbove {
+		if !rofiConfirm(confirmPrompt(len(selected), total, "")) {
+			return nil
+		}
+	}
+
+	openBookmarks(selected, newWindow)
+	return nil
+}
+
+// rofiConfirm asks a yes/no question in a separate rofi window
+func rofiConfirm(prompt string) bool {
+	rofi := exec.Command("rofi", "-dmenu", "-i", "-no-custom", "-p", prompt)
+	rofi.Stdin = strings.NewReader("Yes\nNo\n")
+	output, err := rofi.Output()
+	return err == nil && strings.TrimSpace(string(output)) == "Yes"
+}
+
+// confirmPrompt describes what is about to be opened
+func confirmPrompt(count int, total int, folder string) string {
+	prompt := fmt.Sprintf("Open %d bookmarks", count)
+	if folder != "" {
+		prompt += " from " + folder
+	}
+	if total > count {
+		prompt += fmt.Sprintf(" (first %d of %d)", count, total)
+	}
+	return prompt + "?"
+}
+
+// runRofiCommand handles a selected ROFI_INFO command. It reports whether
+// it produced rofi's output, like runRofiAction.
+func runRofiCommand(info string) bool {
+	command := strings.TrimPrefix(info, rofiCommandPrefix)
+	if path, ok := strings.CutPrefix(command, "open-folder:"); ok {
+		return rofiOpenFolder(path, true)
+	}
+	logger.GetLogger().Error("Unknown rofi command", "command", info)
+	return false
+}
+
+// rofiOpenFolder opens every bookmark in a folder from rofi's script mode.
+// Above the confirmation threshold it first shows a confirmation list whose
+// entry runs this again with confirmed set.
+func rofiOpenFolder(path string, confirmed bool) bool {
+	log := logger.GetLogger()
+
+	all, err := db.GetBookmarks()
+	if err != nil {
+		log.Error("Error getting bookmarks from database", "error", err)
+		return false
+	}
+	var bookmarks bookmark.Bookmarks
+	for _, bm := range all.RemoveDuplicates() {
+		if strings.Trim(bm.Path, "/") == strings.Trim(path, "/") {
+			bookmarks = append(bookmarks, bm)
+		}
+	}
+	if len(bookmarks) == 0 {
+		return false
+	}
+
+	max, confirmAbove := multiSelectLimits()
+	total := len(bookmarks)
+	if total > max {
+		bookmarks = bookmarks[:max]
+	}
+
+	if !confirmed && (total > max || len(bookmarks) > confirmAbove) {
+		fmt.Println("\x00prompt\x1fConfirm")
+		rofiKeepData()
+		fmt.Println("\x00message\x1f" + escapePango(confirmPrompt(len(bookmarks), total, strings.Trim(path, "/"))))
+		fmt.Println("Yes\x00info\x1f" + rofiCommandPrefix + "open-folder:" + path)
+		// No info, so selecting it shows the list again
+		fmt.Println("No")
+		return true
+	}
+
+	openBookmarks(bookmarks, config.GlobalConfig.Rofi.MultiSelect.NewWindow)
+	return true
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zwo-bot/marks/bookmark"
+)
+
+// rofiTagsCommand prefixes ROFI_INFO values that select a set of tags
+const rofiTagsCommand = rofiCommandPrefix + "tags:"
+
+// selectedTags decodes the tag selection kept in ROFI_DATA
+func selectedTags(data string) []string {
+	var tags []string
+	for _, tag := range strings.Split(data, ",") {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// hasTags reports whether bm has all of the given tags
+func hasTags(bm bookmark.Bookmark, tags []string) bool {
+	for _, want := range tags {
+		found := false
+		for _, tag := range bm.Tags {
+			if tag == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// printRofiTags lists tags with their bookmark counts. Once tags are
+// selected it lists the bookmarks having all of them, preceded by the tags
+// that narrow the selection further. The selection is kept in ROFI_DATA.
+func printRofiTags(bookmarks bookmark.Bookmarks, data string) {
+	selected := selectedTags(data)
+	isSelected := make(map[string]bool, len(selected))
+	for _, tag := range selected {
+		isSelected[tag] = true
+	}
+
+	var matching bookmark.Bookmarks
+	counts := make(map[string]int)
+	for _, bm := range bookmarks {
+		if !hasTags(bm, selected) {
+			continue
+		}
+		matching = append(matching, bm)
+		for _, tag := range bm.Tags {
+			if !isSelected[tag] {
+				counts[tag]++
+			}
+		}
+	}
+
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if counts[tags[i]] != counts[tags[j]] {
+			return counts[tags[i]] > counts[tags[j]]
+		}
+		return strings.ToLower(tags[i]) < strings.ToLower(tags[j])
+	})
+
+	fmt.Println("\x00data\x1f" + strings.Join(selected, ","))
+	if len(selected) == 0 {
+		fmt.Println("\x00prompt\x1fTags")
+	} else {
+		fmt.Println("\x00prompt\x1f" + strings.Join(selected, " + "))
+		// Going back drops the most recently selected tag
+		parent := strings.Join(selected[:len(selected)-1], ",")
+		fmt.Println("..\x00info\x1f" + rofiTagsCommand + parent + "\x1ficon\x1fgo-up")
+	}
+
+	for _, tag := range tags {
+		label := escapePango(tag)
+		if len(selected) > 0 {
+			label = "+ " + label
+		}
+		next := strings.Join(append(append([]string{}, selected...), tag), ",")
+		fmt.Printf("<b>%s</b>  <span alpha='70%%'>%d</span>\x00info\x1f%s\x1ficon\x1ftag\x1fmeta\x1f%s\n",
+			label, counts[tag], rofiTagsCommand+next, tag)
+	}
+
+	if len(selected) == 0 {
+		return
+	}
+	for _, bm := range matching {
+		fmt.Println(rofiRow(bm))
+	}
+}
@@ -3,9 +3,11 @@ package cmd
 import (
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/zwo-bot/marks/db"
+	"github.com/zwo-bot/marks/internal/api"
 	"github.com/zwo-bot/marks/internal/config"
 	"github.com/zwo-bot/marks/internal/logger"
 )
@@ -15,12 +17,19 @@ var rootOptions struct {
 	logLevel    string
 	configPath  string
 	logFilePath string
+	dbPath      string
 }
 
 var rootCmd = &cobra.Command{
 	Use:   "marks",
 	Short: "Bookmark manager for launchers",
 	Long:  `A simple bookmark manager for rofi and other launchers`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Config is loaded by now
+		if cmd.Annotations[lazyDatabase] == "" {
+			connectDatabase()
+		}
+	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
 		// Close database connection
 		if err := db.CloseDatabase(); err != nil {
@@ -58,6 +67,12 @@ func init() {
 		"",
 		"Path to config file",
 	)
+	rootCmd.PersistentFlags().StringVar(
+		&rootOptions.dbPath,
+		"db",
+		"",
+		"Path to the bookmark database (default $XDG_DATA_HOME/marks/bookmarks.db)",
+	)
 
 	cobra.OnInitialize(func() {
 		// Initialize logger first
@@ -82,12 +97,60 @@ func init() {
 		}
 		log.Debug("Config loaded", "config", config.GlobalConfig)
 
-		// Initialize database after config is loaded
-		err = db.ConnectDatabase()
+		path, err := databasePath()
 		if err != nil {
-			log.Error("Error connecting to database", "error", err)
+			log.Error("Error finding the database", "error", err)
 			os.Exit(1)
 		}
-		log.Debug("Database connected")
+		db.SetPath(path)
+		api.SetDatabase(path)
+		log.Debug("Using database", "path", path, "socket", api.SocketPath())
 	})
 }
+
+// databasePath returns the database file from --db, the config or the
+// default location. An old database in the working directory is moved to
+// the default location.
+func databasePath() (string, error) {
+	path := rootOptions.dbPath
+	if path == "" {
+		path = config.GlobalConfig.Database
+	}
+	if path == "" {
+		path, err := db.DefaultPath()
+		if err != nil {
+			return "", err
+		}
+		return path, db.MigrateLegacyDatabase(path)
+	}
+
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, rest)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return path, os.MkdirAll(filepath.Dir(path), 0755)
+}
+
+// lazyDatabase is the annotation of commands that usually get their
+// bookmarks from the daemon and open the database themselves when needed
+const lazyDatabase = "lazy-database"
+
+// connectDatabase opens the database unless it is open already
+func connectDatabase() {
+	if db.DB != nil {
+		return
+	}
+	log := logger.GetLogger()
+	if err := db.ConnectDatabase(); err != nil {
+		log.Error("Error connecting to database", "error", err)
+		os.Exit(1)
+	}
+	log.Debug("Database connected")
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/db"
+	"github.com/zwo-bot/marks/internal/config"
+	"github.com/zwo-bot/marks/internal/opener"
+)
+
+var (
+	routeCmd = &cobra.Command{
+		Use:   "route",
+		Short: "Inspect URL routing rules",
+		Long:  `Inspect the routing rules that decide which command opens a URL.`,
+	}
+
+	routeTestCmd = &cobra.Command{
+		Use:   "test <url>",
+		Short: "Show which routing rule matches a URL",
+		Long:  `Show which routing rule matches a URL and the command marks would run to open it.`,
+		Args:  cobra.ExactArgs(1),
+		Run:   testRoute,
+	}
+)
+
+func init() {
+	routeCmd.AddCommand(routeTestCmd)
+	rootCmd.AddCommand(routeCmd)
+}
+
+func testRoute(cmd *cobra.Command, args []string) {
+	uri := args[0]
+
+	index, err := opener.MatchRoute(uri)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	if index < 0 {
+		fmt.Println("No routing rule matches")
+	} else {
+		route := config.GlobalConfig.Routes[index]
+		var matcher []string
+		if route.Match != "" {
+			matcher = append(matcher, "match "+route.Match)
+		}
+		if route.Regex != "" {
+			matcher = append(matcher, "regex "+route.Regex)
+		}
+		fmt.Printf("Rule %d matches (%s)\n", index+1, strings.Join(matcher, ", "))
+	}
+
+	// Use the cached bookmark, if any, to show the source browser fallback
+	bm, err := db.GetBookmarkByURI(uri)
+	if err != nil {
+		bm = &bookmark.Bookmark{URI: uri}
+	}
+	argv, err := opener.Command(*bm, opener.Options{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Command: %s\n", quoteCommand(argv))
+}
+
+// quoteCommand joins argv for display, quoting arguments with spaces
+func quoteCommand(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg == "" || strings.ContainsAny(arg, " \t'\"") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
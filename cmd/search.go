@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/db"
+	"github.com/zwo-bot/marks/internal/api"
+	"github.com/zwo-bot/marks/internal/export"
+	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/internal/query"
+)
+
+var (
+	searchFormat string
+	searchLimit  int
+	searchFields []string
+	searchCmd    = &cobra.Command{
+		Use:   "search <query>",
+		Short: "Search bookmarks",
+		Long: `Search cached bookmarks by title, URL, path, description and tags, best matches first.
+The query accepts the same filters as --query, e.g. 'marks search kube tag:work -source:chrome'.`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  searchBookmarks,
+		// Searches are answered by the daemon when it runs
+		Annotations: map[string]string{lazyDatabase: "true"},
+	}
+)
+
+func init() {
+	searchCmd.Flags().StringVarP(&searchFormat, "format", "f", "text", "Output format ("+strings.Join(export.Names(), "|")+")")
+	searchCmd.Flags().StringSliceVar(&searchFields, "fields", nil, "Fields of the json, ndjson, yaml and csv formats ("+strings.Join(export.Fields, ",")+")")
+	searchCmd.Flags().IntVarP(&searchLimit, "limit", "n", 20, "Maximum number of results (0 for no limit)")
+	rootCmd.AddCommand(searchCmd)
+}
+
+func searchBookmarks(cmd *cobra.Command, args []string) {
+	log := logger.GetLogger()
+
+	if _, err := export.Get(searchFormat); err != nil {
+		log.Error("Invalid format", "error", err)
+		os.Exit(1)
+	}
+
+	text := strings.Join(args, " ")
+	q, err := query.Parse(text)
+	if err != nil {
+		log.Error("Invalid query", "error", err)
+		os.Exit(1)
+	}
+
+	// Checking every link takes longer than a client waits for the daemon,
+	// so is:dead is only evaluated here
+	var bookmarks bookmark.Bookmarks
+	served := false
+	if q.CheckOffline() == nil {
+		bookmarks, served = requestBookmarks(api.Request{Method: api.MethodSearch, Query: text, Limit: searchLimit})
+	}
+	if !served {
+		connectDatabase()
+		bookmarks, err = db.QueryBookmarks(q, searchLimit)
+		if err != nil {
+			log.Error("Error searching bookmarks", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := export.Write(os.Stdout, searchFormat, bookmarks, export.Options{Fields: searchFields}); err != nil {
+		log.Error("Error writing bookmarks", "format", searchFormat, "error", err)
+		os.Exit(1)
+	}
+}
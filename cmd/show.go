@@ -1,21 +1,29 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/zwo-bot/marks/bookmark"
-	"github.com/zwo-bot/marks/db"
+	"github.com/zwo-bot/marks/internal/config"
+	"github.com/zwo-bot/marks/internal/export"
 	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/internal/query"
+	"github.com/zwo-bot/marks/internal/render"
 	"github.com/zwo-bot/marks/plugins"
+	"github.com/zwo-bot/marks/plugins/external"
 )
 
 var (
-	outputFormat     string
+	outputFormat    string
+	outputFields    []string
 	showDeduplicate bool
+	showQuery       string
+	showTemplate    string
 	showCmd         = &cobra.Command{
 		Use:   "show",
 		Short: "Show bookmarks",
@@ -27,14 +35,26 @@ var (
 	listPluginsCmd = &cobra.Command{
 		Use:   "list-plugins",
 		Short: "List available plugins",
-		Long:  `List available browser plugins that can provide bookmarks`,
-		Run:   listPlugins,
+		Long: `List the plugins that provide bookmarks: the built-in browser plugins and
+external marks-plugin-* executables found in the plugins directory or on
+$PATH.`,
+		Run: listPlugins,
 	}
 )
 
 func init() {
-	showCmd.Flags().StringVarP(&outputFormat, "format", "f", "json", "Output format (text|json)")
+	showCmd.Flags().StringVarP(&outputFormat, "format", "f", "json", "Output format ("+strings.Join(export.Names(), "|")+")")
+	showCmd.Flags().StringSliceVar(&outputFields, "fields", nil, "Fields of the json, ndjson, yaml and csv formats ("+strings.Join(export.Fields, ",")+")")
+	// --columns reads more naturally for CSV
+	showCmd.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "columns" {
+			name = "fields"
+		}
+		return pflag.NormalizedName(name)
+	})
 	showCmd.Flags().BoolVarP(&showDeduplicate, "deduplicate", "d", true, "Remove duplicate bookmarks")
+	showCmd.Flags().StringVarP(&showQuery, "query", "q", "", `Filter bookmarks, e.g. 'tag:go -tag:old source:firefox folder:Work added:<30d "exact phrase"'`)
+	showCmd.Flags().StringVarP(&showTemplate, "template", "t", "", "Go text/template printed per bookmark, e.g. '{{ .Title }} ({{ reldate .Added }})'")
 	rootCmd.AddCommand(showCmd)
 	rootCmd.AddCommand(listPluginsCmd)
 }
@@ -42,22 +62,21 @@ func init() {
 func showBookmarks(cmd *cobra.Command, args []string) {
 	log := logger.GetLogger()
 
-	// First get bookmarks from DB for fast response
-	bookmarks, err := db.GetBookmarks()
+	if _, err := export.Get(outputFormat); err != nil {
+		log.Error("Invalid format", "error", err)
+		os.Exit(1)
+	}
+
+	q, err := query.Parse(queryString(cmd, showQuery, config.GlobalConfig.Show.Query))
 	if err != nil {
-		log.Error("Error getting bookmarks from database", "error", err)
-		// If we can't get from DB, try getting directly from plugins
-		p := plugins.Init()
-		bookmarks = p.GetBookmarks()
-	} else if len(bookmarks) == 0 {
-		// If DB is empty, get from plugins
-		log.Debug("No bookmarks in database, getting from plugins")
-		p := plugins.Init()
-		bookmarks = p.GetBookmarks()
-		// Save to DB for next time
-		if err := db.UpdateBookmarks(bookmarks); err != nil {
-			log.Error("Error saving initial bookmarks to database", "error", err)
-		}
+		log.Error("Invalid query", "error", err)
+		os.Exit(1)
+	}
+
+	bookmarks, err := loadBookmarks(q)
+	if err != nil {
+		log.Error("Error querying bookmarks in database", "error", err)
+		os.Exit(1)
 	}
 
 	// Deduplicate if requested
@@ -65,55 +84,64 @@ func showBookmarks(cmd *cobra.Command, args []string) {
 		bookmarks = bookmarks.RemoveDuplicates()
 	}
 
-	// Output bookmarks in the requested format
-	switch outputFormat {
-	case "json":
-		if err := outputJSON(bookmarks); err != nil {
-			log.Error("Error outputting JSON", "error", err)
-		}
-	case "text":
-		outputText(bookmarks)
-	default:
-		log.Debug("Unknown format, using text", "format", outputFormat)
-		outputText(bookmarks)
+	// Most used bookmarks first
+	rankBookmarks(bookmarks)
+
+	// An explicit --format wins over a configured template
+	templateText := showTemplate
+	if templateText == "" && !cmd.Flags().Changed("format") {
+		templateText = config.GlobalConfig.Show.Template
 	}
 
-	// Spawn the update command as a separate process
-	args = []string{"update"}
-	
-	// Pass config path if it was specified
-	if rootOptions.configPath != "" {
-		args = append(args, "--config", rootOptions.configPath)
+	// Output bookmarks in the requested format
+	if templateText != "" {
+		err = outputTemplate(bookmarks, templateText)
+	} else {
+		err = export.Write(os.Stdout, outputFormat, bookmarks, export.Options{Fields: outputFields})
 	}
-	
-	// Pass log level to maintain consistent logging
-	args = append(args, "--log-level", rootOptions.logLevel)
-
-	updateCmd := exec.Command(os.Args[0], args...)
-	// Start the command without waiting for it to complete
-	if err := updateCmd.Start(); err != nil {
-		log.Debug("Error starting update process", "error", err)
+	if err != nil {
+		log.Error("Error writing bookmarks", "format", outputFormat, "error", err)
+		os.Exit(1)
 	}
+
+	// Refresh the cache in the background for the next call
+	spawnUpdate()
 }
 
-func outputJSON(bookmarks bookmark.Bookmarks) error {
-	data, err := json.MarshalIndent(bookmarks, "", "  ")
+// outputTemplate prints the template once per bookmark, each on its own line
+func outputTemplate(bookmarks bookmark.Bookmarks, text string) error {
+	tmpl, err := render.Parse("show", text)
 	if err != nil {
 		return err
 	}
-	fmt.Println(string(data))
-	return nil
-}
 
-func outputText(bookmarks bookmark.Bookmarks) {
-	for _, bookmark := range bookmarks {
-		fmt.Printf("%s\t%s\n", bookmark.Title, bookmark.URI)
+	for _, bm := range bookmarks {
+		line, err := tmpl.Render(bm)
+		if err != nil {
+			return err
+		}
+		fmt.Println(strings.TrimSuffix(line, "\n"))
 	}
+	return nil
 }
 
 func listPlugins(cmd *cobra.Command, args []string) {
-	p := plugins.Init()
-	for _, plugin := range p.ListPlugins() {
-		fmt.Println(plugin)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tNAME\tTYPE\tPRIORITY\tPROVIDED BY")
+	for _, plugin := range plugins.Init() {
+		instance, ok := plugin.(*plugins.Instance)
+		if !ok {
+			continue
+		}
+		// External plugins show where they come from
+		providedBy := "built-in"
+		if ext, ok := instance.Unwrap().(*external.ExternalPlugin); ok {
+			providedBy = ext.Path
+			if ext.Description() != "" {
+				providedBy += " (" + ext.Description() + ")"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", instance.GetName(), instance.Name, instance.Type, instance.Priority, providedBy)
 	}
+	w.Flush()
 }
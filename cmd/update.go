@@ -1,36 +1,228 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
 	"github.com/spf13/cobra"
 	"github.com/zwo-bot/marks/db"
 	"github.com/zwo-bot/marks/internal/logger"
 	"github.com/zwo-bot/marks/plugins"
+	"github.com/zwo-bot/marks/plugins/interfaces"
 )
 
-var updateCmd = &cobra.Command{
-	Use:   "update",
-	Short: "Update bookmarks database",
-	Long:  `Update bookmarks database with fresh data from configured browsers.`,
-	Run:   updateBookmarks,
-}
+var (
+	updateForce         bool
+	updateSkipIfRunning bool
+	updateTimeout       time.Duration
+	updateCmd           = &cobra.Command{
+		Use:   "update",
+		Short: "Update bookmarks database",
+		Long: `Update bookmarks database with fresh data from configured browsers.
+Browsers whose bookmarks haven't changed since the last update are skipped.
+Browsers are read concurrently; one that fails or takes longer than
+--timeout keeps the bookmarks of its last update. Only one update runs at
+a time; a second one waits for it to finish. With --force the search index
+is rebuilt as well.`,
+		Run: updateBookmarks,
+	}
+)
 
 func init() {
+	updateCmd.Flags().BoolVarP(&updateForce, "force", "f", false, "Read all browsers, even if their bookmarks haven't changed, and rebuild the search index")
+	updateCmd.Flags().BoolVar(&updateSkipIfRunning, "skip-if-running", false, "Exit instead of waiting when another update is running")
+	updateCmd.Flags().DurationVar(&updateTimeout, "timeout", plugins.DefaultTimeout, "How long to wait for each browser's bookmarks")
 	rootCmd.AddCommand(updateCmd)
 }
 
 func updateBookmarks(cmd *cobra.Command, args []string) {
 	log := logger.GetLogger()
 
-	// Get fresh bookmarks from plugins
-	p := plugins.Init()
-	bookmarks := p.GetBookmarks()
+	unlock, err := db.LockUpdate(!updateSkipIfRunning)
+	if errors.Is(err, db.ErrUpdateRunning) {
+		log.Debug("Another update is running, skipping")
+		return
+	}
+	if err != nil {
+		log.Error("Error locking the database for the update", "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	reports := updatePlugins(ctx, plugins.Init(), updateForce, updateTimeout)
+	reports = append(reports, removeDisabledSources()...)
+	if updateForce {
+		if err := db.RebuildSearchIndex(); err != nil {
+			log.Error("Error rebuilding the search index", "error", err)
+		}
+	}
+	if folded, err := db.CompactUsages(frecencyHalfLife()); err != nil {
+		log.Error("Error compacting the usage history", "error", err)
+	} else if folded > 0 {
+		log.Debug("Compacted the usage history", "folded", folded)
+	}
+	stop()
+	unlock()
+
+	if err := printUpdateReports(os.Stdout, reports); err != nil {
+		log.Error("Error printing the update report", "error", err)
+	}
+	for _, r := range reports {
+		if r.err != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+// updateReport is the outcome of updating the bookmarks of one plugin
+type updateReport struct {
+	plugin string
+	// skipped is set if the fingerprint showed that nothing changed
+	skipped bool
+	// disabled is set if the bookmarks of a disabled plugin were removed
+	disabled bool
+	count    int
+	summary  db.UpdateSummary
+	// err is set if the bookmarks could not be read or saved; the cached
+	// bookmarks of the plugin are kept then
+	err      error
+	duration time.Duration
+}
+
+// updatePlugins replaces the cached bookmarks of the plugins with fresh
+// ones, skipping plugins whose fingerprint shows that nothing changed since
+// the last update. The plugins are read concurrently, each for at most
+// timeout, and saved one after another. A plugin that fails keeps its
+// cached bookmarks, and nothing is saved once ctx is done.
+func updatePlugins(ctx context.Context, p plugins.Plugins, force bool, timeout time.Duration) []updateReport {
+	reports := make([]updateReport, len(p))
+	fingerprints := make(map[string]string, len(p))
+	var stale plugins.Plugins
+	for i, plugin := range p {
+		reports[i].plugin = plugin.GetName()
+		fingerprint, changed := checkFingerprint(plugin, force)
+		if !changed {
+			reports[i].skipped = true
+			continue
+		}
+		fingerprints[plugin.GetName()] = fingerprint
+		stale = append(stale, plugin)
+	}
+
+	results := make(map[string]plugins.Result, len(stale))
+	for _, result := range stale.Fetch(ctx, timeout) {
+		results[result.Plugin.GetName()] = result
+	}
+
+	for i := range reports {
+		result, ok := results[reports[i].plugin]
+		if !ok {
+			continue
+		}
+		reports[i].duration = result.Duration
+		reports[i].count = len(result.Bookmarks)
+		reports[i].err = result.Err
+		if reports[i].err == nil {
+			reports[i].err = ctx.Err()
+		}
+		// An interrupted update is not the plugin's fault
+		if result.Err != nil && ctx.Err() == nil {
+			if err := db.RecordSourceError(reports[i].plugin, result.Err); err != nil {
+				logger.GetLogger().Error("Error recording the failed update", "plugin", reports[i].plugin, "error", err)
+			}
+		}
+		if reports[i].err != nil {
+			continue
+		}
+		reports[i].summary, reports[i].err = saveBookmarks(result, fingerprints[reports[i].plugin])
+	}
+	return reports
+}
+
+// removeDisabledSources removes the cached bookmarks of disabled plugins
+func removeDisabledSources() []updateReport {
+	cached, err := db.SourcesByType()
+	if err != nil {
+		logger.GetLogger().Error("Error reading the cached sources", "error", err)
+		return nil
+	}
+
+	var reports []updateReport
+	for _, source := range plugins.DisabledSources(cached) {
+		summary, err := db.UpdateSourceBookmarks(source, "", nil)
+		if err != nil {
+			logger.GetLogger().Error("Error removing bookmarks of disabled plugin", "plugin", source, "error", err)
+		}
+		if err != nil || summary.Changed() {
+			reports = append(reports, updateReport{plugin: source, disabled: true, summary: summary, err: err})
+		}
+	}
+	return reports
+}
 
-	log.Debug("Got bookmarks from plugins", "count", len(bookmarks))
+// checkFingerprint returns the fingerprint of the plugin's bookmarks and
+// whether they may have changed since the last update
+func checkFingerprint(plugin interfaces.Plugin, force bool) (string, bool) {
+	log := logger.GetLogger().With("plugin", plugin.GetName())
 
-	// Update the database
-	if err := db.UpdateBookmarks(bookmarks); err != nil {
+	var fingerprint string
+	if f, ok := plugin.(interfaces.Fingerprinter); ok {
+		var err error
+		if fingerprint, err = f.Fingerprint(); err != nil {
+			log.Debug("Could not fingerprint bookmarks", "error", err)
+		}
+	}
+
+	if fingerprint != "" && !force {
+		previous, err := db.GetFingerprint(plugin.GetName())
+		if err != nil {
+			log.Error("Error reading fingerprint", "error", err)
+		} else if previous == fingerprint {
+			log.Debug("Bookmarks unchanged, skipping", "fingerprint", fingerprint)
+			return fingerprint, false
+		}
+	}
+	return fingerprint, true
+}
+
+// saveBookmarks replaces the cached bookmarks of a plugin with the ones it
+// returned
+func saveBookmarks(result plugins.Result, fingerprint string) (db.UpdateSummary, error) {
+	log := logger.GetLogger().With("plugin", result.Plugin.GetName())
+
+	summary, err := db.UpdateSourceBookmarks(result.Plugin.GetName(), fingerprint, result.Bookmarks)
+	if err != nil {
 		log.Error("Error updating bookmarks in database", "error", err)
-	} else {
-		log.Debug("Updated bookmarks in database", "count", len(bookmarks))
+		return summary, err
+	}
+	log.Info("Updated bookmarks in database",
+		"added", summary.Added, "updated", summary.Updated, "removed", summary.Removed,
+		"unchanged", summary.Unchanged, "removed_tags", summary.RemovedTags)
+	log.Debug("Recorded fingerprint", "fingerprint", fingerprint)
+	return summary, nil
+}
+
+// printUpdateReports writes a line per plugin telling what the update did
+func printUpdateReports(out io.Writer, reports []updateReport) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, r := range reports {
+		switch {
+		case r.skipped:
+			fmt.Fprintf(w, "%s\tunchanged\t\n", r.plugin)
+		case r.disabled && r.err == nil:
+			fmt.Fprintf(w, "%s\tdisabled\tremoved %d cached bookmarks\n", r.plugin, r.summary.Removed)
+		case r.err != nil:
+			fmt.Fprintf(w, "%s\tfailed\t%v, kept the cached bookmarks\n", r.plugin, r.err)
+		default:
+			fmt.Fprintf(w, "%s\tupdated\t%d bookmarks in %s: %s\n", r.plugin, r.count, r.duration.Round(time.Millisecond), r.summary)
+		}
 	}
+	return w.Flush()
 }
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// ChangeWatcher notices commits of other connections to the database, such
+// as those of other marks processes. It asks SQLite for the data_version of
+// a connection of its own, which changes whenever another connection
+// commits.
+type ChangeWatcher struct {
+	mu      sync.Mutex
+	conn    *sql.Conn
+	version int64
+}
+
+// WatchChanges starts watching the database for changes
+func WatchChanges() (*ChangeWatcher, error) {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	w := &ChangeWatcher{conn: conn}
+	if _, err := w.Changed(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Changed reports whether the database changed since the last call
+func (w *ChangeWatcher) Changed() (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var version int64
+	if err := w.conn.QueryRowContext(context.Background(), "PRAGMA data_version").Scan(&version); err != nil {
+		return false, err
+	}
+	changed := version != w.version
+	w.version = version
+	return changed, nil
+}
+
+// Close stops watching and returns the connection
+func (w *ChangeWatcher) Close() error {
+	return w.conn.Close()
+}
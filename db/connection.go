@@ -3,6 +3,7 @@ package db
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/zwo-bot/marks/bookmark"
 	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/internal/xdg"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
@@ -17,18 +19,42 @@ import (
 
 var DB *gorm.DB
 
-// CacheDir returns the path to the favicon cache directory
+// databaseOptions open the cache in WAL mode, so that readers don't block
+// while an update writes, and wait for locks instead of failing with
+// "database is locked". Transactions take the write lock when they begin,
+// so that two writers don't deadlock upgrading their read locks.
+const databaseOptions = "?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+
+// readOnlyOptions open the cache without changing it, not even its journal
+// mode
+const readOnlyOptions = "?_busy_timeout=5000&_query_only=true"
+
+// readOnly is set by SetReadOnly
+var readOnly bool
+
+// ErrReadOnly is returned instead of storing favicons in read-only mode
+var ErrReadOnly = errors.New("marks runs read-only")
+
+// SetReadOnly makes OpenDatabase open the database read-only and the
+// favicon functions skip storing and caching icons, so that plugins can
+// read their bookmarks without a usable database and without writing
+// anything
+func SetReadOnly() {
+	readOnly = true
+}
+
+// ReadOnly reports whether SetReadOnly was called
+func ReadOnly() bool {
+	return readOnly
+}
+
+// CacheDir returns the path to the favicon cache directory, creating it if
+// needed
 func CacheDir() (string, error) {
-	cacheHome := os.Getenv("XDG_CACHE_HOME")
-	if cacheHome == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", fmt.Errorf("could not get user home directory: %v", err)
-		}
-		cacheHome = filepath.Join(home, ".cache")
+	cacheDir, err := cacheDirPath()
+	if err != nil {
+		return "", err
 	}
-
-	cacheDir := filepath.Join(cacheHome, "rofi-bookmarks")
 	if err := os.MkdirAll(cacheDir, 0755); err != nil {
 		return "", fmt.Errorf("could not create cache directory: %v", err)
 	}
@@ -36,18 +62,88 @@ func CacheDir() (string, error) {
 	return cacheDir, nil
 }
 
+// cacheDirPath returns the path to the favicon cache directory
+func cacheDirPath() (string, error) {
+	cacheHome, err := xdg.CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheHome, "favicons"), nil
+}
+
+// FaviconState describes the favicon cache
+type FaviconState struct {
+	// Dir is the directory of the icon files
+	Dir   string `json:"dir"`
+	Files int    `json:"files"`
+	// Size is the total size of the icon files in bytes
+	Size int64 `json:"size"`
+	// Stored is the number of favicons in the database
+	Stored int64 `json:"stored"`
+	// Missing is the number of bookmarks whose domain has no favicon
+	Missing int64 `json:"missing"`
+}
+
+// FaviconStatus returns the state of the favicon cache
+func FaviconStatus() (FaviconState, error) {
+	var state FaviconState
+	dir, err := cacheDirPath()
+	if err != nil {
+		return state, err
+	}
+	state.Dir = dir
+
+	// A missing directory has no files
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return state, err
+	}
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			state.Files++
+			state.Size += info.Size()
+		}
+	}
+
+	if err := DB.Model(&Favicon{}).Count(&state.Stored).Error; err != nil {
+		return state, err
+	}
+	err = DB.Model(&Bookmark{}).Where("domain NOT IN (?)", DB.Model(&Favicon{}).Select("domain")).Count(&state.Missing).Error
+	return state, err
+}
+
+// ConnectDatabase opens the database, migrates it to the current schema
+// and prepares the search index
 func ConnectDatabase() error {
+	err := OpenDatabase()
+	if err == nil {
+		_, err = Migrate()
+	}
+	if err == nil {
+		err = setupSearchIndex()
+	}
+	return err
+}
+
+// OpenDatabase opens the database without migrating it, read-only after
+// SetReadOnly
+func OpenDatabase() error {
+	options := databaseOptions
+	if readOnly {
+		options = readOnlyOptions
+	}
 	var err error
-	DB, err = gorm.Open(sqlite.Open("bookmarks.db"), &gorm.Config{
+	DB, err = gorm.Open(sqlite.Open(databasePath+options), &gorm.Config{
 		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
 	})
-	if err == nil {
-		err = DB.AutoMigrate(&Tag{}, &Favicon{}, &Bookmark{})
-	}
 	return err
 }
 
 func CloseDatabase() error {
+	if DB == nil {
+		// Never connected
+		return nil
+	}
 	db, err := DB.DB()
 	if err != nil {
 		return err
@@ -62,7 +158,11 @@ func GetBookmarks() (bookmark.Bookmarks, error) {
 		return nil, err
 	}
 
-	// Convert db.Bookmark to bookmark.Bookmark
+	return toBookmarks(dbBookmarks), nil
+}
+
+// toBookmarks converts db.Bookmark rows to bookmark.Bookmarks
+func toBookmarks(dbBookmarks []Bookmark) bookmark.Bookmarks {
 	var bookmarks bookmark.Bookmarks
 	for _, b := range dbBookmarks {
 		bm := bookmark.Bookmark{
@@ -72,6 +172,11 @@ func GetBookmarks() (bookmark.Bookmarks, error) {
 			URI:         b.URI,
 			Domain:      b.Domain,
 			Source:      b.Source,
+			Type:        b.Type,
+			Profile:     b.Profile,
+			Added:       b.Added,
+			Frecency:    b.Frecency,
+			Keyword:     b.Keyword,
 			Tags:        make([]string, len(b.Tags)),
 		}
 
@@ -90,7 +195,7 @@ func GetBookmarks() (bookmark.Bookmarks, error) {
 		bookmarks = append(bookmarks, bm)
 	}
 
-	return bookmarks, nil
+	return bookmarks
 }
 
 func SaveBookmark(bm bookmark.Bookmark) error {
@@ -101,64 +206,115 @@ func SaveBookmark(bm bookmark.Bookmark) error {
 		URI:         bm.URI,
 		Domain:      bm.Domain,
 		Source:      bm.Source,
+		Type:        bm.Type,
+		Profile:     bm.Profile,
+		Added:       bm.Added,
+		Frecency:    bm.Frecency,
+		Keyword:     bm.Keyword,
 	}
 	return DB.Save(&dbBookmark).Error
 }
 
-// UpdateBookmarks replaces all bookmarks in the database with new ones
-func UpdateBookmarks(bms bookmark.Bookmarks) error {
-	log := logger.GetLogger()
-
-	// Start transaction
-	tx := DB.Begin()
-	if tx.Error != nil {
-		return tx.Error
+// GetBookmarkByURI returns the first cached bookmark for uri
+func GetBookmarkByURI(uri string) (*bookmark.Bookmark, error) {
+	var dbBookmarks []Bookmark
+	err := DB.Model(&Bookmark{}).Preload("Tags").Where("uri = ?", uri).Limit(1).Find(&dbBookmarks).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(dbBookmarks) == 0 {
+		return nil, gorm.ErrRecordNotFound
 	}
+	bm := toBookmarks(dbBookmarks)[0]
+	return &bm, nil
+}
 
-	// Only delete bookmarks, preserve favicons
-	if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&Bookmark{}).Error; err != nil {
-		tx.Rollback()
-		return err
+// GetBookmarkByKeyword returns the cached bookmark with the given keyword
+func GetBookmarkByKeyword(keyword string) (*bookmark.Bookmark, error) {
+	var dbBookmarks []Bookmark
+	err := DB.Model(&Bookmark{}).Preload("Tags").Where("keyword != '' AND lower(keyword) = lower(?)", keyword).Limit(1).Find(&dbBookmarks).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(dbBookmarks) == 0 {
+		return nil, gorm.ErrRecordNotFound
 	}
+	bm := toBookmarks(dbBookmarks)[0]
+	return &bm, nil
+}
 
-	// Convert bookmark.Bookmarks to db.Bookmark and handle tags
+// GetKeywordBookmarks returns the cached bookmarks with a keyword starting
+// with prefix
+func GetKeywordBookmarks(prefix string) (bookmark.Bookmarks, error) {
 	var dbBookmarks []Bookmark
-	for _, b := range bms {
-		dbBookmark := Bookmark{
-			Title:       b.Title,
-			Path:        b.Path,
-			Description: b.Description,
-			URI:         b.URI,
-			Domain:      b.Domain,
-			Source:      b.Source,
-			Tags:        make([]Tag, 0, len(b.Tags)),
+	err := DB.Model(&Bookmark{}).Preload("Tags").
+		Where(`keyword != '' AND keyword LIKE ? ESCAPE '\'`, likeEscaper.Replace(prefix)+"%").
+		Order("keyword").Find(&dbBookmarks).Error
+	if err != nil {
+		return nil, err
+	}
+	return toBookmarks(dbBookmarks), nil
+}
+
+// DeleteBookmark removes all bookmarks for uri from the cache and keeps
+// them out of future updates. The browsers' bookmarks are not touched.
+func DeleteBookmark(uri string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(DeletedBookmark{URI: uri}).FirstOrCreate(&DeletedBookmark{}).Error; err != nil {
+			return err
 		}
 
-		// Process tags
-		for _, tagName := range b.Tags {
-			var tag Tag
-			// Find or create tag
-			result := tx.FirstOrCreate(&tag, Tag{Name: tagName})
-			if result.Error != nil {
-				tx.Rollback()
-				return result.Error
-			}
-			dbBookmark.Tags = append(dbBookmark.Tags, tag)
+		var dbBookmarks []Bookmark
+		if err := tx.Where("uri = ?", uri).Find(&dbBookmarks).Error; err != nil {
+			return err
+		}
+		if len(dbBookmarks) == 0 {
+			return nil
+		}
+		if err := tx.Select("Tags").Delete(&dbBookmarks).Error; err != nil {
+			return err
+		}
+		if _, err := collectGarbage(tx); err != nil {
+			return err
 		}
 
-		dbBookmarks = append(dbBookmarks, dbBookmark)
-	}
+		ids := make([]uint, len(dbBookmarks))
+		for i, b := range dbBookmarks {
+			ids[i] = b.ID
+		}
+		return updateSearchIndex(tx, ids)
+	})
+}
 
-	// Save new bookmarks with their tags
-	if err := tx.Create(&dbBookmarks).Error; err != nil {
-		tx.Rollback()
+// UpdateBookmarks makes the cache match bms. Cached rows of bookmarks that
+// are still there keep their ID. Bookmarks deleted with DeleteBookmark are
+// left out.
+func UpdateBookmarks(bms bookmark.Bookmarks) (UpdateSummary, error) {
+	var summary UpdateSummary
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// The fingerprints no longer describe what is cached
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&SourceState{}).Error; err != nil {
+			return err
+		}
+		var err error
+		summary, err = syncBookmarks(tx, "", bms)
 		return err
-	}
-
-	log.Debug("Created bookmarks with tags", "bookmark_count", len(dbBookmarks))
+	})
+	return summary, err
+}
 
-	// Commit transaction
-	return tx.Commit().Error
+// UpdateSourceBookmarks makes the cached bookmarks of one source match bms,
+// leaving those of other sources alone, and records the source's fingerprint
+func UpdateSourceBookmarks(source string, fingerprint string, bms bookmark.Bookmarks) (UpdateSummary, error) {
+	var summary UpdateSummary
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if summary, err = syncBookmarks(tx, source, bms); err != nil {
+			return err
+		}
+		return saveFingerprint(tx, source, fingerprint)
+	})
+	return summary, err
 }
 
 // GetFaviconByDomain retrieves a favicon from the database by domain
@@ -181,6 +337,9 @@ func GetFaviconByDomain(domain string) (*Favicon, error) {
 // SaveFavicon stores a favicon in the database
 func SaveFavicon(data []byte, urlStr string) (*Favicon, error) {
 	log := logger.GetLogger()
+	if readOnly {
+		return nil, ErrReadOnly
+	}
 
 	// Parse URL to get domain
 	parsedURL, err := url.Parse(urlStr)
@@ -223,6 +382,9 @@ func SaveFavicon(data []byte, urlStr string) (*Favicon, error) {
 func SaveAndCacheIcon(iconData []byte, urlStr string) (string, error) {
 	log := logger.GetLogger()
 
+	if readOnly {
+		return "", ErrReadOnly
+	}
 	if len(iconData) == 0 {
 		log.Debug("No icon data provided", "url", urlStr)
 		return "", fmt.Errorf("no icon data provided")
@@ -264,9 +426,13 @@ func SaveAndCacheIcon(iconData []byte, urlStr string) (string, error) {
 	return iconPath, nil
 }
 
-// GetIconPath returns the filesystem path for a favicon, fetching from database if needed
+// GetIconPath returns the filesystem path for a favicon, fetching from database if needed.
+// In read-only mode there is none.
 func GetIconPath(urlStr string) (string, error) {
 	log := logger.GetLogger()
+	if readOnly {
+		return "", nil
+	}
 
 	// Parse URL to get domain
 	parsedURL, err := url.Parse(urlStr)
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Initialize("error", "")
+	os.Exit(m.Run())
+}
+
+// openTestDatabase connects to a new database in a temporary directory
+func openTestDatabase(t *testing.T) {
+	t.Helper()
+	oldPath := databasePath
+	SetPath(filepath.Join(t.TempDir(), databaseFile))
+	if err := ConnectDatabase(); err != nil {
+		t.Fatalf("ConnectDatabase: %v", err)
+	}
+	t.Cleanup(func() {
+		CloseDatabase()
+		DB = nil
+		databasePath = oldPath
+	})
+}
+
+// titles returns the sorted titles of bms
+func titles(bms bookmark.Bookmarks) []string {
+	result := []string{}
+	for _, bm := range bms {
+		result = append(result, bm.Title)
+	}
+	sort.Strings(result)
+	return result
+}
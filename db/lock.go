@@ -0,0 +1,50 @@
+package db
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrUpdateRunning is returned by LockUpdate when another process is
+// updating the cache and the caller doesn't want to wait for it
+var ErrUpdateRunning = errors.New("another update is running")
+
+// errLocked is returned by lockFile when the lock is held and the caller
+// doesn't wait
+var errLocked = errors.New("locked")
+
+// LockUpdate takes the lock that allows one process at a time to update the
+// cache. With wait it blocks until a running update is done, otherwise it
+// returns ErrUpdateRunning. The returned function releases the lock; it is
+// also released when the process exits.
+func LockUpdate(wait bool) (func(), error) {
+	unlock, err := lockFile(databasePath+".lock", wait)
+	if err == errLocked {
+		return nil, ErrUpdateRunning
+	}
+	return unlock, err
+}
+
+// LockDaemon marks the daemon as running until the returned function is
+// called or the process exits. It fails if a daemon is running already.
+func LockDaemon() (func(), error) {
+	unlock, err := lockFile(databasePath+".daemon", false)
+	if err == errLocked {
+		return nil, errors.New("the daemon is running already")
+	}
+	return unlock, err
+}
+
+// DaemonRunning reports whether a daemon keeps the cache current
+func DaemonRunning() bool {
+	// A daemon creates the lock file, checking doesn't
+	if _, err := os.Stat(databasePath + ".daemon"); err != nil {
+		return false
+	}
+	unlock, err := lockFile(databasePath+".daemon", false)
+	if err != nil {
+		return err == errLocked
+	}
+	unlock()
+	return false
+}
@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package db
+
+import "github.com/zwo-bot/marks/internal/logger"
+
+// lockFile can't lock files on this platform. It always succeeds, so
+// updates aren't serialized and a running daemon isn't detected.
+func lockFile(path string, wait bool) (func(), error) {
+	logger.GetLogger().Debug("File locks are not supported on this platform", "lock", path)
+	return func() {}, nil
+}
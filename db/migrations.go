@@ -0,0 +1,220 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zwo-bot/marks/internal/logger"
+	"gorm.io/gorm"
+)
+
+// migration changes the schema from the previous version to version.
+// Migrations are never edited once released; later changes get a new
+// migration, so that every database ends up with the same schema.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *gorm.DB) error
+}
+
+// migrations are the schema changes in order. The columns of the models in
+// models.go must match the schema after the last one.
+var migrations = []migration{
+	{1, "initial schema", initialSchema},
+	{2, "index bookmark identity and tag links", func(tx *gorm.DB) error {
+		return execAll(tx,
+			"CREATE INDEX IF NOT EXISTS `idx_bookmarks_identity` ON `bookmarks`(`source`,`profile`,`uri`)",
+			"CREATE INDEX IF NOT EXISTS `idx_bookmark_tags_tag_id` ON `bookmark_tags`(`tag_id`)",
+		)
+	}},
+	{3, "record update errors of sources", func(tx *gorm.DB) error {
+		return execAll(tx,
+			"ALTER TABLE `source_states` ADD `last_error` text",
+			"ALTER TABLE `source_states` ADD `last_error_at` datetime",
+		)
+	}},
+	{4, "record the plugin type of bookmarks", func(tx *gorm.DB) error {
+		// Forgetting the fingerprints makes the next update read every
+		// source again, which fills in the type
+		return execAll(tx,
+			"ALTER TABLE `bookmarks` ADD `type` text",
+			"UPDATE `source_states` SET `fingerprint` = ''",
+		)
+	}},
+	{5, "fold old usages into scores", func(tx *gorm.DB) error {
+		return execAll(tx,
+			"CREATE TABLE IF NOT EXISTS `usage_scores` (`uri` text,`score` real,`scored_at` datetime,PRIMARY KEY (`uri`))",
+		)
+	}},
+}
+
+// SchemaMigration records a migration applied to the database
+type SchemaMigration struct {
+	Version   int       `gorm:"column:version;primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"column:name"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+// MigrationState is a migration and when it was applied, if it was
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	// Unknown is set for migrations of a newer marks
+	Unknown bool
+}
+
+// SchemaVersion returns the schema version this marks creates
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// DatabaseVersion returns the schema version of the database, 0 if it
+// was never migrated. It doesn't write to the database.
+func DatabaseVersion() (int, error) {
+	if !DB.Migrator().HasTable(&SchemaMigration{}) {
+		return 0, nil
+	}
+	var version int
+	err := DB.Model(&SchemaMigration{}).Select("coalesce(max(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// Migrate applies the pending migrations, each in a transaction, and
+// returns how many it applied. It refuses to touch a database of a newer
+// marks.
+func Migrate() (int, error) {
+	log := logger.GetLogger()
+
+	if err := createMigrationsTable(DB); err != nil {
+		return 0, err
+	}
+	version, err := DatabaseVersion()
+	if err != nil {
+		return 0, err
+	}
+	if version > SchemaVersion() {
+		return 0, fmt.Errorf("database %s has schema version %d, but this marks only knows version %d; please update marks",
+			databasePath, version, SchemaVersion())
+	}
+
+	applied := 0
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		done := false
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			// Another process may have migrated while this one waited for
+			// the write lock
+			var count int64
+			if err := tx.Model(&SchemaMigration{}).Where("version = ?", m.version).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return nil
+			}
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			done = true
+			return tx.Create(&SchemaMigration{Version: m.version, Name: m.name, AppliedAt: time.Now().UTC()}).Error
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %v", m.version, m.name, err)
+		}
+		if done {
+			log.Info("Migrated database", "version", m.version, "name", m.name)
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// MigrationStatus returns all migrations known to this marks or applied to
+// the database, in order
+func MigrationStatus() ([]MigrationState, error) {
+	var records []SchemaMigration
+	if DB.Migrator().HasTable(&SchemaMigration{}) {
+		if err := DB.Order("version").Find(&records).Error; err != nil {
+			return nil, err
+		}
+	}
+	applied := make(map[int]SchemaMigration, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+
+	var states []MigrationState
+	for _, m := range migrations {
+		state := MigrationState{Version: m.version, Name: m.name}
+		if r, ok := applied[m.version]; ok {
+			state.AppliedAt = &r.AppliedAt
+			delete(applied, m.version)
+		}
+		states = append(states, state)
+	}
+	for _, r := range records {
+		if _, ok := applied[r.Version]; ok {
+			states = append(states, MigrationState{Version: r.Version, Name: r.Name, AppliedAt: &r.AppliedAt, Unknown: true})
+		}
+	}
+	return states, nil
+}
+
+func createMigrationsTable(db *gorm.DB) error {
+	return db.Exec("CREATE TABLE IF NOT EXISTS `schema_migrations` (`version` integer,`name` text,`applied_at` datetime,PRIMARY KEY (`version`))").Error
+}
+
+// initialSchema creates the tables as AutoMigrate did before there were
+// migrations. Databases of that time may lack columns added later, which
+// are added.
+func initialSchema(tx *gorm.DB) error {
+	err := execAll(tx,
+		"CREATE TABLE IF NOT EXISTS `tags` (`id` integer,`name` text,PRIMARY KEY (`id`))",
+		"CREATE TABLE IF NOT EXISTS `favicons` (`id` integer,`data` blob,`domain` text,PRIMARY KEY (`id`))",
+		"CREATE TABLE IF NOT EXISTS `bookmarks` (`id` integer,`title` text,`path` text,`description` text,`uri` text,`domain` text,`source` text,`profile` text,`added` datetime,`frecency` integer,`keyword` text,PRIMARY KEY (`id`))",
+		"CREATE TABLE IF NOT EXISTS `bookmark_tags` (`bookmark_id` integer,`tag_id` integer,PRIMARY KEY (`bookmark_id`,`tag_id`),CONSTRAINT `fk_bookmark_tags_bookmark` FOREIGN KEY (`bookmark_id`) REFERENCES `bookmarks`(`id`),CONSTRAINT `fk_bookmark_tags_tag` FOREIGN KEY (`tag_id`) REFERENCES `tags`(`id`))",
+		"CREATE TABLE IF NOT EXISTS `usages` (`id` integer,`uri` text,`opened_at` datetime,PRIMARY KEY (`id`))",
+		"CREATE TABLE IF NOT EXISTS `deleted_bookmarks` (`id` integer,`uri` text,PRIMARY KEY (`id`))",
+		"CREATE TABLE IF NOT EXISTS `source_states` (`id` integer,`source` text,`fingerprint` text,`updated_at` datetime,PRIMARY KEY (`id`))",
+	)
+	if err != nil {
+		return err
+	}
+
+	columns := []struct{ table, column, kind string }{
+		{"bookmarks", "description", "text"},
+		{"bookmarks", "domain", "text"},
+		{"bookmarks", "source", "text"},
+		{"bookmarks", "profile", "text"},
+		{"bookmarks", "added", "datetime"},
+		{"bookmarks", "frecency", "integer"},
+		{"bookmarks", "keyword", "text"},
+	}
+	for _, c := range columns {
+		if tx.Migrator().HasColumn(c.table, c.column) {
+			continue
+		}
+		if err := tx.Exec(fmt.Sprintf("ALTER TABLE `%s` ADD `%s` %s", c.table, c.column, c.kind)).Error; err != nil {
+			return err
+		}
+	}
+
+	return execAll(tx,
+		"CREATE INDEX IF NOT EXISTS `idx_bookmarks_keyword` ON `bookmarks`(`keyword`)",
+		"CREATE INDEX IF NOT EXISTS `idx_usages_uri` ON `usages`(`uri`)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS `idx_deleted_bookmarks_uri` ON `deleted_bookmarks`(`uri`)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS `idx_source_states_source` ON `source_states`(`source`)",
+	)
+}
+
+// execAll runs SQL statements in order
+func execAll(tx *gorm.DB, statements ...string) error {
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
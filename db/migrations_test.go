@@ -0,0 +1,190 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// legacyBookmark is the bookmark model of marks before there were
+// migrations, when the schema was created by AutoMigrate
+type legacyBookmark struct {
+	ID          uint   `gorm:"primaryKey"`
+	Title       string `gorm:"column:title"`
+	Path        string `gorm:"column:path"`
+	Description string `gorm:"column:description"`
+	URI         string `gorm:"column:uri"`
+	Domain      string `gorm:"column:domain"`
+	Tags        []Tag  `gorm:"many2many:bookmark_tags;joinForeignKey:BookmarkID"`
+	Source      string `gorm:"column:source"`
+}
+
+func (legacyBookmark) TableName() string {
+	return "bookmarks"
+}
+
+// createLegacyDatabase writes a database as marks did before migrations
+func createLegacyDatabase(t *testing.T, path string) {
+	t.Helper()
+	legacy, err := gorm.Open(sqlite.Open(path), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("opening legacy database: %v", err)
+	}
+	if err := legacy.AutoMigrate(&Tag{}, &Favicon{}, &legacyBookmark{}); err != nil {
+		t.Fatalf("creating legacy schema: %v", err)
+	}
+	err = legacy.Create(&legacyBookmark{
+		Title:  "Old bookmark",
+		URI:    "https://example.com/",
+		Domain: "example.com",
+		Path:   "toolbar",
+		Tags:   []Tag{{Name: "kept"}},
+		Source: "Firefox",
+	}).Error
+	if err != nil {
+		t.Fatalf("writing legacy bookmark: %v", err)
+	}
+	sqlDB, _ := legacy.DB()
+	sqlDB.Close()
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), databaseFile)
+	createLegacyDatabase(t, path)
+
+	oldPath := databasePath
+	SetPath(path)
+	t.Cleanup(func() {
+		CloseDatabase()
+		DB = nil
+		databasePath = oldPath
+	})
+
+	if err := OpenDatabase(); err != nil {
+		t.Fatalf("OpenDatabase: %v", err)
+	}
+	if version, err := DatabaseVersion(); err != nil || version != 0 {
+		t.Fatalf("DatabaseVersion of the legacy database = %d, %v, want 0", version, err)
+	}
+	applied, err := Migrate()
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if applied != len(migrations) {
+		t.Errorf("applied %d migrations, want %d", applied, len(migrations))
+	}
+	if version, err := DatabaseVersion(); err != nil || version != SchemaVersion() {
+		t.Errorf("DatabaseVersion = %d, %v, want %d", version, err, SchemaVersion())
+	}
+
+	// Migrating again does nothing
+	if applied, err := Migrate(); err != nil || applied != 0 {
+		t.Errorf("second Migrate applied %d, %v, want 0", applied, err)
+	}
+	states, err := MigrationStatus()
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	for _, s := range states {
+		if s.AppliedAt == nil || s.Unknown {
+			t.Errorf("migration %d (%s) is not recorded as applied", s.Version, s.Name)
+		}
+	}
+
+	// The old bookmark is kept and the current models work on the schema
+	if err := setupSearchIndex(); err != nil {
+		t.Fatalf("setupSearchIndex: %v", err)
+	}
+	cached, err := GetBookmarks()
+	if err != nil {
+		t.Fatalf("GetBookmarks: %v", err)
+	}
+	if len(cached) != 1 || cached[0].Title != "Old bookmark" || !reflect.DeepEqual(cached[0].Tags, []string{"kept"}) {
+		t.Fatalf("cached bookmarks after migrating: %+v", cached)
+	}
+	old := cached[0]
+	old.Keyword = "ex"
+	old.Profile = "default"
+	if _, err := UpdateSourceBookmarks("Firefox", "f1", bookmark.Bookmarks{old}); err != nil {
+		t.Fatalf("UpdateSourceBookmarks: %v", err)
+	}
+	if bm, err := GetBookmarkByKeyword("ex"); err != nil || bm.URI != old.URI {
+		t.Errorf("GetBookmarkByKeyword = %+v, %v", bm, err)
+	}
+	if err := RecordSourceError("Firefox", errors.New("broken")); err != nil {
+		t.Errorf("RecordSourceError: %v", err)
+	}
+	if err := RecordOpen(old.URI); err != nil {
+		t.Errorf("RecordOpen: %v", err)
+	}
+}
+
+func TestMigrateRefusesNewerDatabase(t *testing.T) {
+	openTestDatabase(t)
+
+	future := SchemaMigration{Version: SchemaVersion() + 1, Name: "from the future"}
+	if err := DB.Create(&future).Error; err != nil {
+		t.Fatalf("recording migration: %v", err)
+	}
+	if _, err := Migrate(); err == nil {
+		t.Error("Migrate accepted a database of a newer schema version")
+	}
+
+	states, err := MigrationStatus()
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	last := states[len(states)-1]
+	if last.Version != future.Version || !last.Unknown {
+		t.Errorf("last migration state = %+v, want the unknown version %d", last, future.Version)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), databaseFile)
+	createLegacyDatabase(t, path)
+
+	oldPath := databasePath
+	SetPath(path)
+	SetReadOnly()
+	t.Cleanup(func() {
+		CloseDatabase()
+		DB = nil
+		databasePath = oldPath
+		readOnly = false
+	})
+
+	if err := OpenDatabase(); err != nil {
+		t.Fatalf("OpenDatabase: %v", err)
+	}
+	if version, err := DatabaseVersion(); err != nil || version != 0 {
+		t.Errorf("DatabaseVersion = %d, %v, want 0", version, err)
+	}
+	states, err := MigrationStatus()
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	for _, s := range states {
+		if s.AppliedAt != nil {
+			t.Errorf("migration %d is recorded as applied", s.Version)
+		}
+	}
+	if DB.Migrator().HasTable(&SchemaMigration{}) {
+		t.Error("reading the schema version created schema_migrations")
+	}
+
+	if _, err := SaveAndCacheIcon([]byte("icon"), "https://example.com/"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("SaveAndCacheIcon = %v, want ErrReadOnly", err)
+	}
+	if err := DB.Exec("DELETE FROM `bookmarks`").Error; err == nil {
+		t.Error("the database was opened writable")
+	}
+}
@@ -1,5 +1,7 @@
 package db
 
+import "time"
+
 type Tag struct {
 	ID   uint   `gorm:"primaryKey"`
 	Name string `gorm:"column:name"`
@@ -12,12 +14,39 @@ type Favicon struct {
 }
 
 type Bookmark struct {
-	ID          uint   `gorm:"primaryKey"`
-	Title       string `gorm:"column:title"`
-	Path        string `gorm:"column:path"`
-	Description string `gorm:"column:description"`
-	URI         string `gorm:"column:uri"`
-	Domain      string `gorm:"column:domain"`
-	Tags        []Tag  `gorm:"many2many:bookmark_tags;"`
-	Source      string `gorm:"column:source"`
+	ID          uint      `gorm:"primaryKey"`
+	Title       string    `gorm:"column:title"`
+	Path        string    `gorm:"column:path"`
+	Description string    `gorm:"column:description"`
+	URI         string    `gorm:"column:uri"`
+	Domain      string    `gorm:"column:domain"`
+	Tags        []Tag     `gorm:"many2many:bookmark_tags;"`
+	Source      string    `gorm:"column:source"`
+	Type        string    `gorm:"column:type"`
+	Profile     string    `gorm:"column:profile"`
+	Added       time.Time `gorm:"column:added"`
+	Frecency    int       `gorm:"column:frecency"`
+	Keyword     string    `gorm:"column:keyword;index"`
+}
+
+// Usage records one time a bookmark was opened through marks
+type Usage struct {
+	ID       uint      `gorm:"primaryKey"`
+	URI      string    `gorm:"column:uri;index"`
+	OpenedAt time.Time `gorm:"column:opened_at"`
+}
+
+// UsageScore is the frecency score of the opens of a URI that
+// CompactUsages folded into one row, as it was at ScoredAt
+type UsageScore struct {
+	URI      string    `gorm:"column:uri;primaryKey"`
+	Score    float64   `gorm:"column:score"`
+	ScoredAt time.Time `gorm:"column:scored_at"`
+}
+
+// DeletedBookmark marks a URI the user deleted from marks, so that it is not
+// cached again on the next update
+type DeletedBookmark struct {
+	ID  uint   `gorm:"primaryKey"`
+	URI string `gorm:"column:uri;uniqueIndex"`
 }
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/internal/xdg"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// databaseFile is the name of the database file
+const databaseFile = "bookmarks.db"
+
+// databasePath is the database file opened by ConnectDatabase. The lock
+// files are kept next to it.
+var databasePath = databaseFile
+
+// SetPath sets the database file opened by ConnectDatabase
+func SetPath(path string) {
+	databasePath = path
+}
+
+// Path returns the database file opened by ConnectDatabase
+func Path() string {
+	return databasePath
+}
+
+// DefaultPath returns the database file in the data directory
+func DefaultPath() (string, error) {
+	dir, err := xdg.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, databaseFile), nil
+}
+
+// MigrateLegacyDatabase moves bookmarks.db from the working directory,
+// where marks used to keep it, to path if there is no database at path
+// yet. It does nothing if there is no such file or if it is not a marks
+// database.
+func MigrateLegacyDatabase(path string) error {
+	log := logger.GetLogger()
+
+	legacy, err := filepath.Abs(databaseFile)
+	if err != nil {
+		return err
+	}
+	if legacy == path {
+		return nil
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		return nil
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		log.Debug("Ignoring old database, a database exists already", "old", legacy, "path", path, "error", err)
+		return nil
+	}
+	if ok, err := isMarksDatabase(legacy); !ok {
+		log.Debug("Ignoring bookmarks.db, it is not a marks database", "path", legacy, "error", err)
+		return nil
+	}
+
+	// The write-ahead log holds changes not yet written to the database
+	for _, suffix := range []string{"-wal", "-shm", ""} {
+		if err := moveFile(legacy+suffix, path+suffix); err != nil {
+			return fmt.Errorf("could not move %s to %s: %v", legacy+suffix, path+suffix, err)
+		}
+	}
+	// The lock files are created again next to the new database
+	for _, suffix := range []string{".lock", ".daemon"} {
+		os.Remove(legacy + suffix)
+	}
+
+	log.Info("Moved database", "from", legacy, "to", path)
+	return nil
+}
+
+// isMarksDatabase reports whether path is an SQLite database with the
+// tables every version of marks created. The file is opened read-only.
+func isMarksDatabase(path string) (bool, error) {
+	conn, err := gorm.Open(sqlite.Open(path+readOnlyOptions), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		return false, err
+	}
+	if sqlDB, err := conn.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	var tables int64
+	err = conn.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name IN ('bookmarks', 'bookmark_tags')").Scan(&tables).Error
+	return err == nil && tables == 2, err
+}
+
+// moveFile renames from to to, copying it if they are on different file
+// systems. A missing from is ignored.
+func moveFile(from string, to string) error {
+	err := os.Rename(from, to)
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(to)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(to)
+		return err
+	}
+	return os.Remove(from)
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// inLegacyDirectory changes to a new working directory, where marks used to
+// keep its database, and returns the path of a database in the data
+// directory
+func inLegacyDirectory(t *testing.T) string {
+	t.Helper()
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(dir) })
+
+	data := filepath.Join(t.TempDir(), "marks")
+	if err := os.MkdirAll(data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(data, databaseFile)
+}
+
+func TestMoveLegacyDatabase(t *testing.T) {
+	path := inLegacyDirectory(t)
+	createLegacyDatabase(t, databaseFile)
+
+	if err := MigrateLegacyDatabase(path); err != nil {
+		t.Fatalf("MigrateLegacyDatabase: %v", err)
+	}
+	if _, err := os.Stat(databaseFile); !os.IsNotExist(err) {
+		t.Errorf("the old database is still there: %v", err)
+	}
+	if ok, err := isMarksDatabase(path); !ok {
+		t.Errorf("the moved database is not a marks database: %v", err)
+	}
+}
+
+func TestKeepForeignLegacyDatabase(t *testing.T) {
+	tests := map[string]func(t *testing.T){
+		"other application": func(t *testing.T) {
+			other, err := sql.Open("sqlite3", databaseFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer other.Close()
+			if _, err := other.Exec("CREATE TABLE bookmarks (url TEXT)"); err != nil {
+				t.Fatal(err)
+			}
+		},
+		"not a database": func(t *testing.T) {
+			if err := os.WriteFile(databaseFile, []byte("title,url\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+	for name, create := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := inLegacyDirectory(t)
+			create(t)
+			before, err := os.ReadFile(databaseFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := MigrateLegacyDatabase(path); err != nil {
+				t.Fatalf("MigrateLegacyDatabase: %v", err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("the file was moved to %s: %v", path, err)
+			}
+			if after, err := os.ReadFile(databaseFile); err != nil || string(after) != string(before) {
+				t.Errorf("the file was changed: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeepExistingDatabase(t *testing.T) {
+	path := inLegacyDirectory(t)
+	createLegacyDatabase(t, databaseFile)
+	if err := os.WriteFile(path, []byte("current"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrateLegacyDatabase(path); err != nil {
+		t.Fatalf("MigrateLegacyDatabase: %v", err)
+	}
+	if _, err := os.Stat(databaseFile); err != nil {
+		t.Errorf("the old database is gone: %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "current" {
+		t.Errorf("the database was replaced: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/internal/query"
+)
+
+// likeEscaper escapes LIKE wildcards so values match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// QueryBookmarks returns the bookmarks matching q. Terms that can be
+// expressed in SQL are evaluated by SQLite; the rest (such as is:dead) are
+// evaluated in Go on the remaining rows. Plain words use the full-text
+// index when available and order the results by relevance. A limit of zero
+// or less returns all matches.
+func QueryBookmarks(q *query.Query, limit int) (bookmark.Bookmarks, error) {
+	tx := DB.Model(&Bookmark{}).Preload("Tags")
+
+	var residual query.Query
+	var ftsTerms []string
+	for _, t := range q.Terms {
+		if t.Field == query.FieldText && !t.Negate && ftsAvailable {
+			ftsTerms = append(ftsTerms, ftsTerm(t.Value, !t.Phrase))
+			continue
+		}
+
+		clause, args, ok := termSQL(t)
+		if !ok {
+			residual.Terms = append(residual.Terms, t)
+			continue
+		}
+		if t.Negate {
+			clause = "NOT coalesce((" + clause + "), 0)"
+		} else {
+			clause = "(" + clause + ")"
+		}
+		tx = tx.Where(clause, args...)
+	}
+
+	if len(ftsTerms) > 0 {
+		tx = tx.Joins("JOIN "+searchTable+" ON "+searchTable+".rowid = bookmarks.id").
+			Where(searchTable+" MATCH ?", strings.Join(ftsTerms, " ")).
+			Order("bm25(" + searchTable + ", 10.0, 5.0, 2.0, 1.0, 3.0)")
+	}
+
+	// The limit can only go to SQLite if nothing is filtered afterwards
+	if limit > 0 && residual.IsEmpty() {
+		tx = tx.Limit(limit)
+	}
+
+	var dbBookmarks []Bookmark
+	if err := tx.Find(&dbBookmarks).Error; err != nil {
+		return nil, err
+	}
+
+	bookmarks := residual.Filter(toBookmarks(dbBookmarks))
+	if limit > 0 && len(bookmarks) > limit {
+		bookmarks = bookmarks[:limit]
+	}
+	return bookmarks, nil
+}
+
+// termSQL compiles a query term to a WHERE clause, ignoring negation.
+// Columns are qualified since the full-text table has the same names.
+// It reports false for terms that can only be evaluated in Go.
+func termSQL(t query.Term) (string, []interface{}, bool) {
+	switch t.Field {
+	case query.FieldText:
+		clause, args := textLikeSQL(t.Value)
+		return clause, args, true
+	case query.FieldTag:
+		return `EXISTS (SELECT 1 FROM bookmark_tags bt JOIN tags t ON t.id = bt.tag_id
+			WHERE bt.bookmark_id = bookmarks.id AND t.name = ? COLLATE NOCASE)`,
+			[]interface{}{t.Value}, true
+	case query.FieldSource:
+		return "bookmarks.source = ? COLLATE NOCASE", []interface{}{t.Value}, true
+	case query.FieldDomain:
+		return `bookmarks.domain = ? COLLATE NOCASE OR bookmarks.domain LIKE ? ESCAPE '\'`,
+			[]interface{}{t.Value, "%." + likeEscaper.Replace(t.Value)}, true
+	case query.FieldFolder:
+		// Same normalization as query.FolderKey, done in SQL
+		return `'/' || lower(trim(bookmarks.path, '/')) || '/' LIKE ? ESCAPE '\'`,
+			[]interface{}{"%/" + likeEscaper.Replace(strings.ToLower(t.Value)) + "/%"}, true
+	case query.FieldAdded:
+		clauses := []string{"bookmarks.added > ?"}
+		args := []interface{}{time.Time{}}
+		if !t.From.IsZero() {
+			clauses = append(clauses, "bookmarks.added >= ?")
+			args = append(args, t.From.UTC())
+		}
+		if !t.To.IsZero() {
+			clauses = append(clauses, "bookmarks.added < ?")
+			args = append(args, t.To.UTC())
+		}
+		return strings.Join(clauses, " AND "), args, true
+	}
+	return "", nil, false
+}
+
+// CountBookmarks returns the number of cached bookmarks
+func CountBookmarks() (int64, error) {
+	var count int64
+	err := DB.Model(&Bookmark{}).Count(&count).Error
+	return count, err
+}
+
+// CountBookmarksBySource returns the number of cached bookmarks per source
+func CountBookmarksBySource() (map[string]int64, error) {
+	var rows []struct {
+		Source string
+		Count  int64
+	}
+	err := DB.Model(&Bookmark{}).Select("source, count(*) AS count").Group("source").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		counts[r.Source] = r.Count
+	}
+	return counts, nil
+}
+
+// SourcesByType returns the sources of the cached bookmarks by the plugin
+// type that read them. Bookmarks cached before types were recorded are
+// listed under "".
+func SourcesByType() (map[string][]string, error) {
+	var rows []struct {
+		Source string
+		Type   string
+	}
+	err := DB.Model(&Bookmark{}).Distinct("source", "coalesce(type, '') AS type").Order("source").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string][]string)
+	for _, r := range rows {
+		sources[r.Type] = append(sources[r.Type], r.Source)
+	}
+	return sources, nil
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/internal/query"
+)
+
+var queryTestBookmarks = bookmark.Bookmarks{
+	{
+		Title:  "Kubernetes docs",
+		URI:    "https://kubernetes.io/docs/",
+		Domain: "kubernetes.io",
+		Path:   "toolbar/Work/Infra",
+		Tags:   []string{"k8s", "ops"},
+		Source: "Firefox",
+		Added:  time.Now().AddDate(0, 0, -3).UTC(),
+	},
+	{
+		Title:  "Go packages",
+		URI:    "https://pkg.go.dev/",
+		Domain: "pkg.go.dev",
+		Path:   "toolbar/Dev",
+		Tags:   []string{"go"},
+		Source: "Chrome",
+		Added:  time.Now().AddDate(-2, 0, 0).UTC(),
+	},
+	{
+		Title:       "Old site",
+		URI:         "https://old.example.org/",
+		Domain:      "old.example.org",
+		Path:        "menu",
+		Description: "100% legacy_stuff",
+		Tags:        []string{"old"},
+		Source:      "Firefox",
+	},
+	{
+		Title:       "GitHub",
+		URI:         "https://github.com/zwo-bot/marks",
+		Domain:      "github.com",
+		Path:        "toolbar/Work",
+		Description: "code hosting",
+		Source:      "Chrome",
+	},
+}
+
+func TestQueryBookmarks(t *testing.T) {
+	openTestDatabase(t)
+	if _, err := UpdateBookmarks(queryTestBookmarks); err != nil {
+		t.Fatalf("UpdateBookmarks: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"GitHub", "Go packages", "Kubernetes docs", "Old site"}},
+		{"kube", []string{"Kubernetes docs"}},
+		{"go", []string{"Go packages"}},
+		{"ops", []string{"Kubernetes docs"}},
+		{"work kube", []string{"Kubernetes docs"}},
+		{"-kube", []string{"GitHub", "Go packages", "Old site"}},
+		{`"code hosting"`, []string{"GitHub"}},
+		{`"100%"`, []string{"Old site"}},
+		// LIKE wildcards in values match literally
+		{`-"%"`, []string{"GitHub", "Go packages", "Kubernetes docs"}},
+		{`-"y_s"`, []string{"GitHub", "Go packages", "Kubernetes docs"}},
+		{"tag:go", []string{"Go packages"}},
+		{"tag:OPS", []string{"Kubernetes docs"}},
+		{"-tag:old", []string{"GitHub", "Go packages", "Kubernetes docs"}},
+		{"source:chrome", []string{"GitHub", "Go packages"}},
+		{"-source:chrome", []string{"Kubernetes docs", "Old site"}},
+		{"domain:example.org", []string{"Old site"}},
+		{"domain:go.dev", []string{"Go packages"}},
+		{"domain:hub.com", []string{}},
+		{"folder:work", []string{"GitHub", "Kubernetes docs"}},
+		{"folder:Work/Infra", []string{"Kubernetes docs"}},
+		{"folder:wor", []string{}},
+		{"-folder:work", []string{"Go packages", "Old site"}},
+		{"added:<30d", []string{"Kubernetes docs"}},
+		{"added:>1y", []string{"Go packages"}},
+		{"-added:<30d", []string{"GitHub", "Go packages", "Old site"}},
+		{"tag:k8s source:firefox folder:infra kube", []string{"Kubernetes docs"}},
+		{"hosting tag:nope", []string{}},
+	}
+
+	all, err := GetBookmarks()
+	if err != nil {
+		t.Fatalf("GetBookmarks: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := query.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			bms, err := QueryBookmarks(q, 0)
+			if err != nil {
+				t.Fatalf("QueryBookmarks: %v", err)
+			}
+			if got := titles(bms); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SQL: got %q, want %q", got, tt.want)
+			}
+			// Evaluating in Go, as the daemon does, must give the same
+			if got := titles(q.Filter(all)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Go: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryBookmarksLimit(t *testing.T) {
+	openTestDatabase(t)
+	if _, err := UpdateBookmarks(queryTestBookmarks); err != nil {
+		t.Fatalf("UpdateBookmarks: %v", err)
+	}
+
+	q, _ := query.Parse("-tag:old")
+	bms, err := QueryBookmarks(q, 2)
+	if err != nil {
+		t.Fatalf("QueryBookmarks: %v", err)
+	}
+	if len(bms) != 2 {
+		t.Errorf("got %d bookmarks, want 2", len(bms))
+	}
+}
+
+func TestTermSQLResidual(t *testing.T) {
+	q, _ := query.Parse("is:dead")
+	if _, _, ok := termSQL(q.Terms[0]); ok {
+		t.Error("is:dead was compiled to SQL, it can only be evaluated in Go")
+	}
+}
+
+func TestSearchBookmarks(t *testing.T) {
+	openTestDatabase(t)
+	if _, err := UpdateBookmarks(queryTestBookmarks); err != nil {
+		t.Fatalf("UpdateBookmarks: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"kube", []string{"Kubernetes docs"}},
+		{"kube docs", []string{"Kubernetes docs"}},
+		// Tags are searched with and without FTS5
+		{"k8s", []string{"Kubernetes docs"}},
+		{"old", []string{"Old site"}},
+		{"nothing", []string{}},
+	}
+	for _, tt := range tests {
+		bms, err := SearchBookmarks(tt.query, 0)
+		if err != nil {
+			t.Fatalf("SearchBookmarks(%q): %v", tt.query, err)
+		}
+		if got := titles(bms); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SearchBookmarks(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
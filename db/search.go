@@ -0,0 +1,192 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/internal/logger"
+	"gorm.io/gorm"
+)
+
+// searchTable is the FTS5 virtual table indexing bookmark text columns.
+// Its rowid is the ID of the bookmark row it indexes.
+const searchTable = "bookmarks_fts"
+
+// ftsAvailable is false when the SQLite driver was built without FTS5
+// (the sqlite_fts5 build tag); searches then fall back to LIKE matching.
+var ftsAvailable bool
+
+// setupSearchIndex creates the full-text index if needed and fills it
+// when it is out of step with the bookmarks table
+func setupSearchIndex() error {
+	log := logger.GetLogger()
+
+	err := DB.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS ` + searchTable + ` USING fts5(
+		title, uri, path, description, tags,
+		tokenize = 'unicode61 remove_diacritics 2'
+	)`).Error
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			log.Debug("SQLite built without FTS5, using LIKE search", "error", err)
+			ftsAvailable = false
+			return nil
+		}
+		return err
+	}
+	ftsAvailable = true
+
+	var indexed, stored int64
+	if err := DB.Table(searchTable).Count(&indexed).Error; err != nil {
+		return err
+	}
+	if err := DB.Model(&Bookmark{}).Count(&stored).Error; err != nil {
+		return err
+	}
+	if indexed == stored {
+		return nil
+	}
+
+	log.Debug("Rebuilding search index", "indexed", indexed, "stored", stored)
+	var dbBookmarks []Bookmark
+	if err := DB.Preload("Tags").Find(&dbBookmarks).Error; err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return rebuildSearchIndex(tx, dbBookmarks)
+	})
+}
+
+// RebuildSearchIndex refills the full-text index from all bookmarks
+func RebuildSearchIndex() error {
+	if !ftsAvailable {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var dbBookmarks []Bookmark
+		if err := tx.Preload("Tags").Find(&dbBookmarks).Error; err != nil {
+			return err
+		}
+		return rebuildSearchIndex(tx, dbBookmarks)
+	})
+}
+
+// rebuildSearchIndex replaces the index contents with the given bookmarks.
+// The bookmarks must already be saved so that their IDs are set.
+func rebuildSearchIndex(tx *gorm.DB, dbBookmarks []Bookmark) error {
+	if !ftsAvailable {
+		return nil
+	}
+
+	if err := tx.Exec("DELETE FROM " + searchTable).Error; err != nil {
+		return err
+	}
+	return indexBookmarks(tx, dbBookmarks)
+}
+
+// searchIndexBatch is how many rowids updateSearchIndex passes to one
+// statement, well below SQLite's limit on bound parameters
+const searchIndexBatch = 500
+
+// updateSearchIndex re-indexes the bookmark rows with the given IDs. IDs
+// of deleted rows are dropped from the index, those of inserted or changed
+// rows are indexed with their current contents.
+func updateSearchIndex(tx *gorm.DB, ids []uint) error {
+	if !ftsAvailable {
+		return nil
+	}
+
+	for start := 0; start < len(ids); start += searchIndexBatch {
+		batch := ids[start:min(start+searchIndexBatch, len(ids))]
+		if err := tx.Exec("DELETE FROM "+searchTable+" WHERE rowid IN ?", batch).Error; err != nil {
+			return err
+		}
+		var dbBookmarks []Bookmark
+		if err := tx.Preload("Tags").Where("id IN ?", batch).Find(&dbBookmarks).Error; err != nil {
+			return err
+		}
+		if err := indexBookmarks(tx, dbBookmarks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexBookmarks adds the given bookmarks to the index
+func indexBookmarks(tx *gorm.DB, dbBookmarks []Bookmark) error {
+	for _, b := range dbBookmarks {
+		tags := make([]string, len(b.Tags))
+		for i, tag := range b.Tags {
+			tags[i] = tag.Name
+		}
+
+		err := tx.Exec(
+			"INSERT INTO "+searchTable+" (rowid, title, uri, path, description, tags) VALUES (?, ?, ?, ?, ?, ?)",
+			b.ID, b.Title, b.URI, b.Path, b.Description, strings.Join(tags, " "),
+		).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchBookmarks returns bookmarks matching all words of query, best
+// matches first. Every word is matched as a prefix, so "git" finds
+// "github". A limit of zero or less returns all matches.
+func SearchBookmarks(query string, limit int) (bookmark.Bookmarks, error) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return GetBookmarks()
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+
+	var dbBookmarks []Bookmark
+	tx := DB.Model(&Bookmark{}).Preload("Tags").Limit(limit)
+	if ftsAvailable {
+		// Weights favour title matches, then URI, tags, path and description
+		tx = tx.Joins("JOIN "+searchTable+" ON "+searchTable+".rowid = bookmarks.id").
+			Where(searchTable+" MATCH ?", ftsQuery(terms)).
+			Order("bm25(" + searchTable + ", 10.0, 5.0, 2.0, 1.0, 3.0)")
+	} else {
+		for _, term := range terms {
+			clause, args := textLikeSQL(term)
+			tx = tx.Where("("+clause+")", args...)
+		}
+	}
+
+	if err := tx.Find(&dbBookmarks).Error; err != nil {
+		return nil, err
+	}
+	return toBookmarks(dbBookmarks), nil
+}
+
+// textLikeSQL matches term anywhere in the columns of the full-text index,
+// including tag names, for SQLite built without FTS5
+func textLikeSQL(term string) (string, []interface{}) {
+	like := "%" + likeEscaper.Replace(term) + "%"
+	return `bookmarks.title LIKE ? ESCAPE '\' OR bookmarks.uri LIKE ? ESCAPE '\' OR bookmarks.path LIKE ? ESCAPE '\' OR bookmarks.description LIKE ? ESCAPE '\'
+			OR EXISTS (SELECT 1 FROM bookmark_tags bt JOIN tags t ON t.id = bt.tag_id
+			WHERE bt.bookmark_id = bookmarks.id AND t.name LIKE ? ESCAPE '\')`,
+		[]interface{}{like, like, like, like, like}
+}
+
+// ftsQuery builds an FTS5 query matching every term as a prefix
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = ftsTerm(term, true)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// ftsTerm quotes a term so that FTS5 operators and punctuation in it are
+// taken literally. A quoted term with several words matches as a phrase.
+func ftsTerm(term string, prefix bool) string {
+	quoted := `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	if prefix {
+		quoted += "*"
+	}
+	return quoted
+}
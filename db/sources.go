@@ -0,0 +1,59 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SourceState remembers the fingerprint of a source's bookmarks at its last
+// update, so that unchanged sources can be skipped, and why the last update
+// failed if it did
+type SourceState struct {
+	ID          uint   `gorm:"primaryKey"`
+	Source      string `gorm:"column:source;uniqueIndex"`
+	Fingerprint string `gorm:"column:fingerprint"`
+	// UpdatedAt is the last successful update; it is zero if the source
+	// never updated successfully
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime:false"`
+	// LastError is cleared by the next successful update
+	LastError   string     `gorm:"column:last_error"`
+	LastErrorAt *time.Time `gorm:"column:last_error_at"`
+}
+
+// GetFingerprint returns the fingerprint recorded for source, or "" if the
+// source was never updated on its own
+func GetFingerprint(source string) (string, error) {
+	var states []SourceState
+	if err := DB.Where("source = ?", source).Limit(1).Find(&states).Error; err != nil {
+		return "", err
+	}
+	if len(states) == 0 {
+		return "", nil
+	}
+	return states[0].Fingerprint, nil
+}
+
+// saveFingerprint records the fingerprint of source
+func saveFingerprint(tx *gorm.DB, source string, fingerprint string) error {
+	// A map, as a struct would skip an empty fingerprint
+	return tx.Where(SourceState{Source: source}).
+		Assign(map[string]interface{}{"fingerprint": fingerprint, "updated_at": time.Now().UTC(), "last_error": "", "last_error_at": nil}).
+		FirstOrCreate(&SourceState{}).Error
+}
+
+// RecordSourceError records that updating source failed. Its bookmarks are
+// kept; the fingerprint is cleared, so that the next update reads the
+// source again even if it didn't change.
+func RecordSourceError(source string, updateErr error) error {
+	return DB.Where(SourceState{Source: source}).
+		Assign(map[string]interface{}{"fingerprint": "", "last_error": updateErr.Error(), "last_error_at": time.Now().UTC()}).
+		FirstOrCreate(&SourceState{}).Error
+}
+
+// SourceStates returns the state of all sources ever updated on their own
+func SourceStates() ([]SourceState, error) {
+	var states []SourceState
+	err := DB.Order("source").Find(&states).Error
+	return states, err
+}
@@ -0,0 +1,304 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"gorm.io/gorm"
+)
+
+// UpdateSummary counts the changes an update made to the cache
+type UpdateSummary struct {
+	Added       int
+	Updated     int
+	Removed     int
+	Unchanged   int
+	RemovedTags int // Tags no bookmark uses anymore
+}
+
+func (s UpdateSummary) String() string {
+	return fmt.Sprintf("%d added, %d updated, %d removed, %d unchanged", s.Added, s.Updated, s.Removed, s.Unchanged)
+}
+
+// Changed reports whether the update changed any bookmark
+func (s UpdateSummary) Changed() bool {
+	return s.Added+s.Updated+s.Removed > 0
+}
+
+// identity is the part of a bookmark that stays the same when it is edited
+// in the browser. A URI bookmarked twice in one profile has two rows with
+// the same identity.
+func identity(source string, profile string, uri string) string {
+	return source + "\x00" + profile + "\x00" + uri
+}
+
+// syncBookmarks makes the cached rows match bms. Rows whose identity
+// matches a bookmark are updated in place and keep their ID; other rows are
+// inserted or deleted. With a source only that source's rows are compared.
+func syncBookmarks(tx *gorm.DB, source string, bms bookmark.Bookmarks) (UpdateSummary, error) {
+	var summary UpdateSummary
+
+	var deleted []string
+	if err := tx.Model(&DeletedBookmark{}).Pluck("uri", &deleted).Error; err != nil {
+		return summary, err
+	}
+	isDeleted := make(map[string]bool, len(deleted))
+	for _, uri := range deleted {
+		isDeleted[uri] = true
+	}
+
+	// Existing rows by identity, oldest first
+	scope := tx.Preload("Tags").Order("id")
+	if source != "" {
+		scope = scope.Where("source = ?", source)
+	}
+	var existing []Bookmark
+	if err := scope.Find(&existing).Error; err != nil {
+		return summary, err
+	}
+	byIdentity := make(map[string][]*Bookmark)
+	for i := range existing {
+		b := &existing[i]
+		key := identity(b.Source, b.Profile, b.URI)
+		byIdentity[key] = append(byIdentity[key], b)
+	}
+
+	tags := newTagCache(tx)
+	matched := make(map[uint]bool)
+	// IDs of the rows whose indexed text may have changed
+	var reindex []uint
+	var added []Bookmark
+	pending := bookmarkRows(bms, isDeleted)
+
+	// First pair bookmarks with rows of the same title and path, so that
+	// duplicates keep their rows, then pair the rest in order
+	for _, exact := range []bool{true, false} {
+		var unmatched []Bookmark
+		for _, row := range pending {
+			old := takeRow(byIdentity[identity(row.Source, row.Profile, row.URI)], matched, row, exact)
+			if old == nil {
+				unmatched = append(unmatched, row)
+				continue
+			}
+			changed, err := updateRow(tx, tags, old, row)
+			if err != nil {
+				return summary, err
+			}
+			if changed {
+				summary.Updated++
+				reindex = append(reindex, old.ID)
+			} else {
+				summary.Unchanged++
+			}
+		}
+		pending = unmatched
+	}
+
+	for _, row := range pending {
+		var err error
+		if row.Tags, err = tags.resolve(tagNames(row.Tags)); err != nil {
+			return summary, err
+		}
+		added = append(added, row)
+	}
+	if len(added) > 0 {
+		if err := tx.Create(&added).Error; err != nil {
+			return summary, err
+		}
+	}
+	summary.Added = len(added)
+	for _, row := range added {
+		reindex = append(reindex, row.ID)
+	}
+
+	var vanished []uint
+	for _, b := range existing {
+		if !matched[b.ID] {
+			vanished = append(vanished, b.ID)
+		}
+	}
+	if len(vanished) > 0 {
+		if err := tx.Exec("DELETE FROM bookmark_tags WHERE bookmark_id IN ?", vanished).Error; err != nil {
+			return summary, err
+		}
+		if err := tx.Delete(&Bookmark{}, vanished).Error; err != nil {
+			return summary, err
+		}
+	}
+	summary.Removed = len(vanished)
+	reindex = append(reindex, vanished...)
+
+	removedTags, err := collectGarbage(tx)
+	if err != nil {
+		return summary, err
+	}
+	summary.RemovedTags = removedTags
+
+	// Only the changed rows are re-indexed, those of other sources are left
+	// alone
+	return summary, updateSearchIndex(tx, reindex)
+}
+
+// bookmarkRows converts the bookmarks that weren't deleted with
+// DeleteBookmark to rows. The tags only carry their names.
+func bookmarkRows(bms bookmark.Bookmarks, isDeleted map[string]bool) []Bookmark {
+	var rows []Bookmark
+	for _, b := range bms {
+		if isDeleted[b.URI] {
+			continue
+		}
+		row := Bookmark{
+			Title:       b.Title,
+			Path:        b.Path,
+			Description: b.Description,
+			URI:         b.URI,
+			Domain:      b.Domain,
+			Source:      b.Source,
+			Type:        b.Type,
+			Profile:     b.Profile,
+			Added:       b.Added,
+			Frecency:    b.Frecency,
+			Keyword:     b.Keyword,
+		}
+		for _, name := range b.Tags {
+			row.Tags = append(row.Tags, Tag{Name: name})
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// takeRow returns the first unmatched candidate for row and marks it as
+// matched. With exact, the candidate must also have the same title and path.
+func takeRow(candidates []*Bookmark, matched map[uint]bool, row Bookmark, exact bool) *Bookmark {
+	for _, c := range candidates {
+		if matched[c.ID] {
+			continue
+		}
+		if exact && (c.Title != row.Title || c.Path != row.Path) {
+			continue
+		}
+		matched[c.ID] = true
+		return c
+	}
+	return nil
+}
+
+// updateRow copies the fields and tags of row to old if they differ and
+// reports whether anything changed
+func updateRow(tx *gorm.DB, tags *tagCache, old *Bookmark, row Bookmark) (bool, error) {
+	changed := false
+
+	if !sameFields(*old, row) {
+		err := tx.Model(&Bookmark{ID: old.ID}).Select("*").Omit("ID", "Tags").Updates(&Bookmark{
+			Title:       row.Title,
+			Path:        row.Path,
+			Description: row.Description,
+			URI:         row.URI,
+			Domain:      row.Domain,
+			Source:      row.Source,
+			Type:        row.Type,
+			Profile:     row.Profile,
+			Added:       row.Added,
+			Frecency:    row.Frecency,
+			Keyword:     row.Keyword,
+		}).Error
+		if err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	newTags := tagNames(row.Tags)
+	if !sameStrings(tagNames(old.Tags), newTags) {
+		resolved, err := tags.resolve(newTags)
+		if err != nil {
+			return false, err
+		}
+		if err := tx.Model(&Bookmark{ID: old.ID}).Association("Tags").Replace(resolved); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// sameFields compares the columns of two rows, except ID and tags
+func sameFields(a Bookmark, b Bookmark) bool {
+	return a.Title == b.Title &&
+		a.Path == b.Path &&
+		a.Description == b.Description &&
+		a.URI == b.URI &&
+		a.Domain == b.Domain &&
+		a.Source == b.Source &&
+		a.Type == b.Type &&
+		a.Profile == b.Profile &&
+		a.Added.Equal(b.Added) &&
+		a.Frecency == b.Frecency &&
+		a.Keyword == b.Keyword
+}
+
+// tagCache resolves tag names to rows, creating missing tags
+type tagCache struct {
+	tx   *gorm.DB
+	tags map[string]Tag
+}
+
+func newTagCache(tx *gorm.DB) *tagCache {
+	return &tagCache{tx: tx, tags: make(map[string]Tag)}
+}
+
+func (c *tagCache) resolve(names []string) ([]Tag, error) {
+	resolved := make([]Tag, 0, len(names))
+	for _, name := range names {
+		tag, ok := c.tags[name]
+		if !ok {
+			if err := c.tx.FirstOrCreate(&tag, Tag{Name: name}).Error; err != nil {
+				return nil, err
+			}
+			c.tags[name] = tag
+		}
+		resolved = append(resolved, tag)
+	}
+	return resolved, nil
+}
+
+// collectGarbage removes join rows of missing bookmarks or tags and tags
+// that no bookmark uses. It returns the number of removed tags.
+func collectGarbage(tx *gorm.DB) (int, error) {
+	err := tx.Exec(`DELETE FROM bookmark_tags
+WHERE bookmark_id NOT IN (SELECT id FROM bookmarks) OR tag_id NOT IN (SELECT id FROM tags)`).Error
+	if err != nil {
+		return 0, err
+	}
+	result := tx.Exec("DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM bookmark_tags)")
+	return int(result.RowsAffected), result.Error
+}
+
+func tagNames(tags []Tag) []string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+// sameStrings compares two lists ignoring order and duplicates
+func sameStrings(a []string, b []string) bool {
+	return strings.Join(uniqueSorted(a), "\x00") == strings.Join(uniqueSorted(b), "\x00")
+}
+
+func uniqueSorted(list []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,260 @@
+package db
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zwo-bot/marks/bookmark"
+)
+
+// rowIDs returns the row IDs of the cached bookmarks by title
+func rowIDs(t *testing.T) map[string]uint {
+	t.Helper()
+	var rows []Bookmark
+	if err := DB.Find(&rows).Error; err != nil {
+		t.Fatalf("reading bookmarks: %v", err)
+	}
+	ids := make(map[string]uint, len(rows))
+	for _, r := range rows {
+		ids[r.Title] = r.ID
+	}
+	return ids
+}
+
+// tagNamesInDB returns the sorted names of all tags
+func tagNamesInDB(t *testing.T) []string {
+	t.Helper()
+	names := []string{}
+	if err := DB.Model(&Tag{}).Order("name").Pluck("name", &names).Error; err != nil {
+		t.Fatalf("reading tags: %v", err)
+	}
+	return names
+}
+
+func TestSyncBookmarks(t *testing.T) {
+	openTestDatabase(t)
+
+	docs := bookmark.Bookmark{Title: "Docs", URI: "https://example.com/docs", Path: "toolbar", Tags: []string{"ref"}, Source: "Firefox", Profile: "p1"}
+	blog := bookmark.Bookmark{Title: "Blog", URI: "https://example.com/blog", Tags: []string{"read", "ref"}, Source: "Firefox", Profile: "p1"}
+	news := bookmark.Bookmark{Title: "News", URI: "https://news.example.com/", Source: "Chrome", Profile: "Default"}
+
+	summary, err := UpdateBookmarks(bookmark.Bookmarks{docs, blog, news})
+	if err != nil {
+		t.Fatalf("UpdateBookmarks: %v", err)
+	}
+	if want := (UpdateSummary{Added: 3}); summary != want {
+		t.Errorf("first update: got %+v, want %+v", summary, want)
+	}
+	before := rowIDs(t)
+
+	// Unchanged bookmarks aren't written
+	summary, err = UpdateBookmarks(bookmark.Bookmarks{docs, blog, news})
+	if err != nil {
+		t.Fatalf("UpdateBookmarks: %v", err)
+	}
+	if want := (UpdateSummary{Unchanged: 3}); summary != want {
+		t.Errorf("same bookmarks: got %+v, want %+v", summary, want)
+	}
+
+	// An edited bookmark keeps its row, a vanished one is removed and its
+	// unused tag with it
+	renamed := docs
+	renamed.Title = "Documentation"
+	renamed.Path = "toolbar/Work"
+	renamed.Tags = []string{"ref", "work"}
+	summary, err = UpdateBookmarks(bookmark.Bookmarks{renamed, news})
+	if err != nil {
+		t.Fatalf("UpdateBookmarks: %v", err)
+	}
+	if want := (UpdateSummary{Updated: 1, Removed: 1, Unchanged: 1, RemovedTags: 1}); summary != want {
+		t.Errorf("edit and remove: got %+v, want %+v", summary, want)
+	}
+	after := rowIDs(t)
+	if after["Documentation"] != before["Docs"] {
+		t.Errorf("edited bookmark got row %d, want its old row %d", after["Documentation"], before["Docs"])
+	}
+	if after["News"] != before["News"] {
+		t.Errorf("unchanged bookmark got row %d, want %d", after["News"], before["News"])
+	}
+	if _, ok := after["Blog"]; ok {
+		t.Error("removed bookmark is still cached")
+	}
+	if got, want := tagNamesInDB(t), []string{"ref", "work"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tags: got %q, want %q", got, want)
+	}
+
+	// The search index follows the changes
+	for query, want := range map[string][]string{"documentation": {"Documentation"}, "blog": {}} {
+		found, err := SearchBookmarks(query, 0)
+		if err != nil {
+			t.Fatalf("SearchBookmarks: %v", err)
+		}
+		if got := titles(found); !reflect.DeepEqual(got, want) {
+			t.Errorf("search %q: got %q, want %q", query, got, want)
+		}
+	}
+
+	cached, err := GetBookmarks()
+	if err != nil {
+		t.Fatalf("GetBookmarks: %v", err)
+	}
+	for _, bm := range cached {
+		if bm.Title != "Documentation" {
+			continue
+		}
+		sort.Strings(bm.Tags)
+		if bm.Path != "toolbar/Work" || !reflect.DeepEqual(bm.Tags, []string{"ref", "work"}) {
+			t.Errorf("edited bookmark was cached as %+v", bm)
+		}
+	}
+}
+
+func TestSyncBookmarksDuplicates(t *testing.T) {
+	openTestDatabase(t)
+
+	// The same URI twice in one profile, e.g. in two folders
+	a := bookmark.Bookmark{Title: "A", URI: "https://example.com/", Path: "one", Source: "Firefox"}
+	b := bookmark.Bookmark{Title: "B", URI: "https://example.com/", Path: "two", Source: "Firefox"}
+	if _, err := UpdateBookmarks(bookmark.Bookmarks{a, b}); err != nil {
+		t.Fatalf("UpdateBookmarks: %v", err)
+	}
+	before := rowIDs(t)
+
+	// In a different order each keeps its own row
+	summary, err := UpdateBookmarks(bookmark.Bookmarks{b, a})
+	if err != nil {
+		t.Fatalf("UpdateBookmarks: %v", err)
+	}
+	if want := (UpdateSummary{Unchanged: 2}); summary != want {
+		t.Errorf("got %+v, want %+v", summary, want)
+	}
+	if after := rowIDs(t); !reflect.DeepEqual(after, before) {
+		t.Errorf("rows changed from %v to %v", before, after)
+	}
+}
+
+func TestUpdateSourceBookmarks(t *testing.T) {
+	openTestDatabase(t)
+
+	firefox := bookmark.Bookmark{Title: "Firefox page", URI: "https://example.com/ff", Source: "Firefox"}
+	chrome := bookmark.Bookmark{Title: "Chrome page", URI: "https://example.com/chrome", Source: "Chrome", Type: "chrome"}
+	if _, err := UpdateSourceBookmarks("Firefox", "f1", bookmark.Bookmarks{firefox}); err != nil {
+		t.Fatalf("UpdateSourceBookmarks: %v", err)
+	}
+	if _, err := UpdateSourceBookmarks("Chrome", "c1", bookmark.Bookmarks{chrome}); err != nil {
+		t.Fatalf("UpdateSourceBookmarks: %v", err)
+	}
+
+	// Emptying one source leaves the other alone
+	summary, err := UpdateSourceBookmarks("Firefox", "f2", nil)
+	if err != nil {
+		t.Fatalf("UpdateSourceBookmarks: %v", err)
+	}
+	if want := (UpdateSummary{Removed: 1}); summary != want {
+		t.Errorf("got %+v, want %+v", summary, want)
+	}
+	cached, err := GetBookmarks()
+	if err != nil {
+		t.Fatalf("GetBookmarks: %v", err)
+	}
+	if got, want := titles(cached), []string{"Chrome page"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cached %q, want %q", got, want)
+	} else if cached[0].Type != "chrome" {
+		t.Errorf("cached type %q, want chrome", cached[0].Type)
+	}
+
+	if fingerprint, err := GetFingerprint("Firefox"); err != nil || fingerprint != "f2" {
+		t.Errorf("fingerprint of Firefox = %q, %v, want f2", fingerprint, err)
+	}
+}
+
+func TestSyncBookmarksTombstones(t *testing.T) {
+	openTestDatabase(t)
+
+	keep := bookmark.Bookmark{Title: "Keep", URI: "https://example.com/keep", Tags: []string{"a"}, Source: "Firefox"}
+	gone := bookmark.Bookmark{Title: "Gone", URI: "https://example.com/gone", Tags: []string{"b"}, Source: "Firefox"}
+	goneChrome := gone
+	goneChrome.Source = "Chrome"
+	all := bookmark.Bookmarks{keep, gone, goneChrome}
+	if _, err := UpdateBookmarks(all); err != nil {
+		t.Fatalf("UpdateBookmarks: %v", err)
+	}
+
+	// Deleting removes the URI of every source and its unused tags
+	if err := DeleteBookmark(gone.URI); err != nil {
+		t.Fatalf("DeleteBookmark: %v", err)
+	}
+	if got, want := tagNamesInDB(t), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tags after delete: got %q, want %q", got, want)
+	}
+
+	// The browsers still have it, but it isn't cached again
+	summary, err := UpdateBookmarks(all)
+	if err != nil {
+		t.Fatalf("UpdateBookmarks: %v", err)
+	}
+	if want := (UpdateSummary{Unchanged: 1}); summary != want {
+		t.Errorf("update after delete: got %+v, want %+v", summary, want)
+	}
+	if _, err := UpdateSourceBookmarks("Chrome", "", bookmark.Bookmarks{goneChrome}); err != nil {
+		t.Fatalf("UpdateSourceBookmarks: %v", err)
+	}
+	cached, err := GetBookmarks()
+	if err != nil {
+		t.Fatalf("GetBookmarks: %v", err)
+	}
+	if got, want := titles(cached), []string{"Keep"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cached %q, want %q", got, want)
+	}
+}
+
+// indexedRows returns the rows of the full-text index, ordered by rowid
+func indexedRows(t *testing.T) []map[string]any {
+	t.Helper()
+	var rows []map[string]any
+	if err := DB.Raw("SELECT rowid, title, uri, path, description, tags FROM " + searchTable + " ORDER BY rowid").Scan(&rows).Error; err != nil {
+		t.Fatalf("reading the search index: %v", err)
+	}
+	return rows
+}
+
+func TestSearchIndexUpdates(t *testing.T) {
+	openTestDatabase(t)
+	if !ftsAvailable {
+		t.Skip("SQLite built without FTS5")
+	}
+
+	docs := bookmark.Bookmark{Title: "Docs", URI: "https://example.com/docs", Tags: []string{"ref"}, Source: "Firefox"}
+	blog := bookmark.Bookmark{Title: "Blog", URI: "https://example.com/blog", Source: "Firefox"}
+	news := bookmark.Bookmark{Title: "News", URI: "https://news.example.com/", Source: "Chrome"}
+	if _, err := UpdateSourceBookmarks("Firefox", "", bookmark.Bookmarks{docs, blog}); err != nil {
+		t.Fatalf("UpdateSourceBookmarks: %v", err)
+	}
+	if _, err := UpdateSourceBookmarks("Chrome", "", bookmark.Bookmarks{news}); err != nil {
+		t.Fatalf("UpdateSourceBookmarks: %v", err)
+	}
+
+	// Edit, add and remove bookmarks of one source, then delete one
+	docs.Title = "Documentation"
+	docs.Tags = []string{"ref", "work"}
+	wiki := bookmark.Bookmark{Title: "Wiki", URI: "https://example.com/wiki", Source: "Firefox"}
+	if _, err := UpdateSourceBookmarks("Firefox", "", bookmark.Bookmarks{docs, wiki}); err != nil {
+		t.Fatalf("UpdateSourceBookmarks: %v", err)
+	}
+	if err := DeleteBookmark(wiki.URI); err != nil {
+		t.Fatalf("DeleteBookmark: %v", err)
+	}
+
+	// The updated index is the one a full rebuild makes
+	updated := indexedRows(t)
+	if len(updated) != 2 {
+		t.Errorf("indexed %d rows, want 2: %v", len(updated), updated)
+	}
+	if err := RebuildSearchIndex(); err != nil {
+		t.Fatalf("RebuildSearchIndex: %v", err)
+	}
+	if rebuilt := indexedRows(t); !reflect.DeepEqual(updated, rebuilt) {
+		t.Errorf("updated index %v, rebuilt %v", updated, rebuilt)
+	}
+}
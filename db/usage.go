@@ -0,0 +1,148 @@
+package db
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"gorm.io/gorm"
+)
+
+// defaultHalfLife is used when no half-life is configured
+const defaultHalfLife = 14 * 24 * time.Hour
+
+// compactHalfLives is the age, in half-lives, at which CompactUsages folds
+// an open into the score of its URI. Such an open counts 1/16 or less.
+const compactHalfLives = 4
+
+// minScore is the score below which a folded score is dropped, that of a
+// single open ten half-lives ago
+var minScore = math.Exp2(-10)
+
+// RecordOpen logs that uri was opened through marks
+func RecordOpen(uri string) error {
+	return DB.Create(&Usage{URI: uri, OpenedAt: time.Now().UTC()}).Error
+}
+
+// FrecencyScores returns a score for every URI opened through marks. Each
+// open adds a weight that halves every halfLife, so recent opens count more
+// than old ones and frequently opened URIs accumulate higher scores.
+func FrecencyScores(halfLife time.Duration) (map[string]float64, error) {
+	if halfLife <= 0 {
+		halfLife = defaultHalfLife
+	}
+
+	// Old opens are folded into one score per URI, so only the recent ones
+	// are read one by one
+	var folded []UsageScore
+	if err := DB.Find(&folded).Error; err != nil {
+		return nil, err
+	}
+	var usages []Usage
+	if err := DB.Find(&usages).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	scores := make(map[string]float64, len(folded))
+	for _, s := range folded {
+		scores[s.URI] += decay(s.Score, now.Sub(s.ScoredAt), halfLife)
+	}
+	for _, u := range usages {
+		scores[u.URI] += decay(1, now.Sub(u.OpenedAt), halfLife)
+	}
+	return scores, nil
+}
+
+// CompactUsages folds the opens older than a few half-lives into one score
+// per URI and returns how many it folded. Scores that decayed below that
+// of an open ten half-lives ago are dropped. The scores are folded with
+// halfLife, so changing the half-life later doesn't rescale them.
+func CompactUsages(halfLife time.Duration) (int, error) {
+	if halfLife <= 0 {
+		halfLife = defaultHalfLife
+	}
+
+	// Opens are recorded in UTC, so the times compare as text
+	now := time.Now().UTC()
+	cutoff := now.Add(-compactHalfLives * halfLife)
+	folded := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var old []Usage
+		if err := tx.Where("opened_at < ?", cutoff).Find(&old).Error; err != nil {
+			return err
+		}
+		if len(old) == 0 {
+			return nil
+		}
+		var existing []UsageScore
+		if err := tx.Find(&existing).Error; err != nil {
+			return err
+		}
+
+		scores := make(map[string]float64, len(existing))
+		for _, s := range existing {
+			scores[s.URI] += decay(s.Score, now.Sub(s.ScoredAt), halfLife)
+		}
+		for _, u := range old {
+			scores[u.URI] += decay(1, now.Sub(u.OpenedAt), halfLife)
+		}
+		var kept []UsageScore
+		for uri, score := range scores {
+			if score >= minScore {
+				kept = append(kept, UsageScore{URI: uri, Score: score, ScoredAt: now})
+			}
+		}
+
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&UsageScore{}).Error; err != nil {
+			return err
+		}
+		if len(kept) > 0 {
+			if err := tx.CreateInBatches(&kept, 500).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("opened_at < ?", cutoff).Delete(&Usage{}).Error; err != nil {
+			return err
+		}
+		folded = len(old)
+		return nil
+	})
+	return folded, err
+}
+
+// decay returns what score counts after age
+func decay(score float64, age time.Duration, halfLife time.Duration) float64 {
+	if age < 0 {
+		age = 0
+	}
+	return score * math.Exp2(-float64(age)/float64(halfLife))
+}
+
+// SortByFrecency orders bookmarks by their frecency score, most used first.
+// Bookmarks never opened through marks follow, ordered by the browser's
+// own frecency if browserFallback is set and otherwise left in place.
+func SortByFrecency(bms bookmark.Bookmarks, halfLife time.Duration, browserFallback bool) error {
+	scores, err := FrecencyScores(halfLife)
+	if err != nil {
+		return err
+	}
+	SortByScores(bms, scores, browserFallback)
+	return nil
+}
+
+// SortByScores orders bookmarks like SortByFrecency with scores from
+// FrecencyScores
+func SortByScores(bms bookmark.Bookmarks, scores map[string]float64, browserFallback bool) {
+	sort.SliceStable(bms, func(i, j int) bool {
+		si, sj := scores[bms[i].URI], scores[bms[j].URI]
+		if si != sj {
+			return si > sj
+		}
+		if browserFallback && si == 0 {
+			return bms[i].Frecency > bms[j].Frecency
+		}
+		return false
+	})
+}
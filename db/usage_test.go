@@ -0,0 +1,62 @@
+package db
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCompactUsages(t *testing.T) {
+	openTestDatabase(t)
+
+	const halfLife = 24 * time.Hour
+	now := time.Now().UTC()
+	usages := []Usage{
+		{URI: "https://example.com/recent", OpenedAt: now.Add(-time.Hour)},
+		{URI: "https://example.com/old", OpenedAt: now.Add(-5 * halfLife)},
+		{URI: "https://example.com/old", OpenedAt: now.Add(-6 * halfLife)},
+		{URI: "https://example.com/recent", OpenedAt: now.Add(-7 * halfLife)},
+		{URI: "https://example.com/forgotten", OpenedAt: now.Add(-20 * halfLife)},
+	}
+	if err := DB.Create(&usages).Error; err != nil {
+		t.Fatalf("recording usages: %v", err)
+	}
+	before, err := FrecencyScores(halfLife)
+	if err != nil {
+		t.Fatalf("FrecencyScores: %v", err)
+	}
+
+	folded, err := CompactUsages(halfLife)
+	if err != nil {
+		t.Fatalf("CompactUsages: %v", err)
+	}
+	if folded != 4 {
+		t.Errorf("folded %d usages, want 4", folded)
+	}
+	var left int64
+	if err := DB.Model(&Usage{}).Count(&left).Error; err != nil {
+		t.Fatalf("counting usages: %v", err)
+	}
+	if left != 1 {
+		t.Errorf("%d usages left, want 1", left)
+	}
+
+	// Folding keeps the scores, except those that decayed to nearly nothing
+	after, err := FrecencyScores(halfLife)
+	if err != nil {
+		t.Fatalf("FrecencyScores: %v", err)
+	}
+	if _, ok := after["https://example.com/forgotten"]; ok {
+		t.Error("the score of an open 20 half-lives ago was kept")
+	}
+	for _, uri := range []string{"https://example.com/recent", "https://example.com/old"} {
+		if math.Abs(after[uri]-before[uri]) > 1e-6 {
+			t.Errorf("score of %s changed from %v to %v", uri, before[uri], after[uri])
+		}
+	}
+
+	// Folding again has nothing to do
+	if folded, err := CompactUsages(halfLife); err != nil || folded != 0 {
+		t.Errorf("second CompactUsages = %d, %v, want 0", folded, err)
+	}
+}
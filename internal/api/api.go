@@ -0,0 +1,123 @@
+// Package api is the line-oriented JSON protocol the daemon serves on a
+// Unix socket. Each request is one JSON object on a line and is answered by
+// one JSON object on a line.
+package api
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/internal/export"
+)
+
+// Request methods
+const (
+	// MethodSearch searches like 'marks search', best matches first
+	MethodSearch = "search"
+	// MethodList returns the bookmarks matching a query, most used first
+	MethodList = "list"
+	// MethodOpen returns the command that opens a URL in the browser and
+	// profile of its bookmark and records the open. The client runs the
+	// command, so that the browser starts in the client's session.
+	MethodOpen = "open"
+	// MethodRecordUsage records that a URL was opened
+	MethodRecordUsage = "record-usage"
+)
+
+// Request is a call of one of the methods
+type Request struct {
+	Method      string `json:"method"`
+	Query       string `json:"query,omitempty"`       // search, list
+	Limit       int    `json:"limit,omitempty"`       // search, list; 0 for all
+	Deduplicate bool   `json:"deduplicate,omitempty"` // list
+	URL         string `json:"url,omitempty"`         // open, record-usage
+	Private     bool   `json:"private,omitempty"`     // open
+	NewWindow   bool   `json:"new_window,omitempty"`  // open
+}
+
+// Response answers a request. Error is set if the request failed.
+type Response struct {
+	Error     string     `json:"error,omitempty"`
+	Bookmarks []Bookmark `json:"bookmarks,omitempty"`
+	Command   []string   `json:"command,omitempty"`
+}
+
+// Bookmark is the exported record with the fields clients need to show
+// and open a bookmark like marks does
+type Bookmark struct {
+	export.Record
+	Path    string `json:"path"`
+	Type    string `json:"type"`
+	Profile string `json:"profile"`
+	Keyword string `json:"keyword"`
+	Icon    string `json:"icon"`
+}
+
+// NewBookmarks converts bookmarks for a response
+func NewBookmarks(bms bookmark.Bookmarks) []Bookmark {
+	result := make([]Bookmark, 0, len(bms))
+	for _, bm := range bms {
+		result = append(result, Bookmark{
+			Record:  export.NewRecord(bm),
+			Path:    bm.Path,
+			Type:    bm.Type,
+			Profile: bm.Profile,
+			Keyword: bm.Keyword,
+			Icon:    bm.Icon,
+		})
+	}
+	return result
+}
+
+// ToBookmarks converts the bookmarks of a response back
+func ToBookmarks(list []Bookmark) bookmark.Bookmarks {
+	bms := make(bookmark.Bookmarks, 0, len(list))
+	for _, b := range list {
+		bm := bookmark.Bookmark{
+			Title:       b.Title,
+			Path:        b.Path,
+			Description: b.Description,
+			URI:         b.URL,
+			Domain:      b.Domain,
+			Tags:        b.Tags,
+			Sources:     b.Sources,
+			Type:        b.Type,
+			Profile:     b.Profile,
+			Icon:        b.Icon,
+			Frecency:    b.BrowserFrecency,
+			Keyword:     b.Keyword,
+		}
+		if len(b.Sources) > 0 {
+			bm.Source = b.Sources[0]
+		}
+		if b.Added != nil {
+			bm.Added = *b.Added
+		}
+		bms = append(bms, bm)
+	}
+	return bms
+}
+
+// database is the database file whose daemon is called, see SetDatabase
+var database string
+
+// SetDatabase selects the daemon serving the database file path. Each
+// database has its own daemon, so each gets its own socket.
+func SetDatabase(path string) {
+	database = path
+}
+
+// SocketPath returns the path of the socket of the daemon serving the
+// database in $XDG_RUNTIME_DIR, or in the temporary directory if it is not
+// set. The name holds a short hash of the database path.
+func SocketPath() string {
+	sum := sha256.Sum256([]byte(database))
+	id := fmt.Sprintf("%x", sum[:4])
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "marks-"+id+".sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("marks-%d-%s.sock", os.Getuid(), id))
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ErrNoServer is returned by Call when no daemon serves the API
+var ErrNoServer = errors.New("no marks daemon is running")
+
+// timeout limits how long Call waits for the daemon
+const timeout = 5 * time.Second
+
+// Call sends a request to the daemon and returns its answer. The error
+// wraps ErrNoServer if no daemon listens, so that callers can fall back to
+// the database.
+func Call(req Request) (*Response, error) {
+	conn, err := net.DialTimeout("unix", SocketPath(), timeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoServer, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("could not read response: %v", err)
+	}
+	var resp Response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/zwo-bot/marks/internal/logger"
+)
+
+// maxLine limits the length of a request
+const maxLine = 1 << 20
+
+// Handler answers a request
+type Handler func(Request) Response
+
+// Serve answers requests on a Unix socket at path until ctx is done. A
+// socket left over from a crashed server is replaced; callers make sure no
+// other server runs.
+func Serve(ctx context.Context, path string, handler Handler) error {
+	log := logger.GetLogger()
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not remove old socket: %v", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %v", path, err)
+	}
+	// Only the user may query their bookmarks
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	log.Debug("Serving API", "socket", path)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go serveConn(conn, handler)
+	}
+}
+
+// serveConn answers the requests of one connection until it is closed
+func serveConn(conn net.Conn, handler Handler) {
+	log := logger.GetLogger()
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxLine)
+	encoder := json.NewEncoder(conn)
+	encoder.SetEscapeHTML(false)
+
+	for scanner.Scan() {
+		var req Request
+		var resp Response
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = fmt.Sprintf("invalid request: %v", err)
+		} else {
+			resp = handler(req)
+		}
+		// Encode ends the response with a newline
+		if err := encoder.Encode(resp); err != nil {
+			log.Debug("Error writing API response", "error", err)
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Debug("Error reading API request", "error", err)
+	}
+}
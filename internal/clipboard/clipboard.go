@@ -0,0 +1,39 @@
+// Package clipboard copies text to the system clipboard using the tools
+// available on the desktop (wl-copy on Wayland, xclip or xsel on X11).
+package clipboard
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// candidates lists clipboard tools in order of preference
+func candidates() [][]string {
+	x11 := [][]string{
+		{"xclip", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--input"},
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		return append([][]string{{"wl-copy"}}, x11...)
+	}
+	return x11
+}
+
+// Copy puts text on the clipboard
+func Copy(text string) error {
+	for _, c := range candidates() {
+		path, err := exec.LookPath(c[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, c[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s failed: %v", c[0], err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no clipboard tool found (install wl-clipboard, xclip or xsel)")
+}
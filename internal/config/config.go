@@ -12,6 +12,99 @@ import (
 type AppConfig struct {
 	Plugins        map[string]interface{} `json:"plugins,omitempty"`
 	DefaultBrowser string                 `json:"defaultBrowser"`
+	Show           ShowConfig             `json:"show"`
+	Rofi           RofiConfig             `json:"rofi"`
+	Pick           PickConfig             `json:"pick"`
+	Frecency       FrecencyConfig         `json:"frecency"`
+	Routes         []RouteConfig          `json:"routes,omitempty"`
+	// Keywords maps shortcuts for marks open to URLs, where %s is replaced
+	// by the rest of the arguments. They take precedence over the
+	// keywords of Firefox bookmarks.
+	Keywords map[string]string `json:"keywords,omitempty"`
+	// Database is the path of the bookmark cache, by default
+	// $XDG_DATA_HOME/marks/bookmarks.db. A leading ~/ is the home directory.
+	Database string `json:"database,omitempty"`
+}
+
+// RouteConfig sends URLs matching a domain glob or a regular expression to
+// a specific command. Routes are tried in order, the first match wins.
+type RouteConfig struct {
+	// Match is a domain glob such as *.corp.example.com. A domain without
+	// wildcards also matches its subdomains.
+	Match string `json:"match,omitempty"`
+	// Regex is matched against the whole URL
+	Regex string `json:"regex,omitempty"`
+	// Command is run with %u replaced by the URL, or the URL appended if
+	// there is no %u
+	Command string `json:"command"`
+}
+
+// FrecencyConfig controls how bookmarks are ranked by how often and how
+// recently they were opened through marks
+type FrecencyConfig struct {
+	// HalfLifeDays is the age in days at which an open counts half (default 14)
+	HalfLifeDays float64 `json:"half_life_days,omitempty"`
+	// BrowserFallback orders bookmarks never opened through marks by the
+	// browser's own frecency instead of leaving them in source order
+	BrowserFallback bool `json:"browser_fallback"`
+}
+
+// ShowConfig holds defaults for the show command
+type ShowConfig struct {
+	// Query is the filter applied when --query is not given
+	Query string `json:"query,omitempty"`
+	// Template is a text/template printing one line per bookmark. It is
+	// used when neither --template nor --format is given.
+	Template string `json:"template,omitempty"`
+}
+
+// PickConfig holds defaults for the pick command
+type PickConfig struct {
+	// Launcher is the menu program used when --launcher is not given. When
+	// empty an installed launcher is detected.
+	Launcher string `json:"launcher,omitempty"`
+	// Query is the filter applied when --query is not given
+	Query string `json:"query,omitempty"`
+	// Template is a text/template for the shown text of each bookmark
+	Template string `json:"template,omitempty"`
+}
+
+// RofiConfig holds defaults for the rofi command
+type RofiConfig struct {
+	// Query is the filter applied when --query is not given
+	Query string `json:"query,omitempty"`
+	// Keybindings maps rofi's kb-custom-N keys to actions. When empty a
+	// default set is used.
+	Keybindings []RofiKeybinding `json:"keybindings,omitempty"`
+	// MultiSelect configures --multi-select and the open-folder action
+	MultiSelect RofiMultiSelectConfig `json:"multi_select"`
+	// Template is a text/template for the displayed row, which may use
+	// Pango markup
+	Template string `json:"template,omitempty"`
+	// MetaTemplate is a text/template for the row's meta field, which
+	// rofi matches against but doesn't show
+	MetaTemplate string `json:"meta_template,omitempty"`
+}
+
+// RofiMultiSelectConfig limits how many bookmarks are opened at once
+type RofiMultiSelectConfig struct {
+	// Max is the most bookmarks opened at once (default 20)
+	Max int `json:"max,omitempty"`
+	// ConfirmAbove asks before opening more bookmarks than this (default 5)
+	ConfirmAbove int `json:"confirm_above,omitempty"`
+	// NewWindow opens the bookmarks in a new browser window
+	NewWindow bool `json:"new_window,omitempty"`
+}
+
+// RofiKeybinding binds an action to one of rofi's custom keys
+type RofiKeybinding struct {
+	// Custom is N of rofi's kb-custom-N (1-19)
+	Custom int `json:"custom"`
+	// Action is one of copy-url, copy-markdown, open-private,
+	// open-with:<command>, open-folder, details, delete or reset
+	Action string `json:"action"`
+	// Key is shown in rofi's message line, defaults to rofi's Alt+N
+	Key string `json:"key,omitempty"`
 }
 
 // Global configuration variable
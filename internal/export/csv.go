@@ -0,0 +1,45 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+
+	"github.com/zwo-bot/marks/bookmark"
+)
+
+func init() {
+	Register("csv", writeCSV)
+}
+
+// writeCSV writes a header row and one row per bookmark with the selected
+// record fields
+func writeCSV(w io.Writer, bookmarks bookmark.Bookmarks, opts Options) error {
+	columns := opts.Fields
+	if len(columns) == 0 {
+		columns = DefaultCSVFields
+	}
+
+	// Fail on unknown columns before writing anything
+	if err := checkFields(columns); err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	row := make([]string, len(columns))
+	for _, bm := range bookmarks {
+		rec := NewRecord(bm)
+		for i, name := range columns {
+			row[i], _ = fieldText(rec, name)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,138 @@
+// Package export writes bookmarks in the output formats of the show and
+// search commands. Formats register themselves by name in Register.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/zwo-bot/marks/bookmark"
+)
+
+// Options modify the output of a format
+type Options struct {
+	// Fields selects the record fields written by structured formats, all
+	// of them when empty. See Fields for the names.
+	Fields []string
+}
+
+// WriteFunc writes bookmarks to w
+type WriteFunc func(w io.Writer, bookmarks bookmark.Bookmarks, opts Options) error
+
+// formats holds all registered formats
+var formats = make(map[string]WriteFunc)
+
+// Register registers an output format with the given name
+func Register(name string, write WriteFunc) {
+	if _, exists := formats[name]; exists {
+		return
+	}
+	formats[name] = write
+}
+
+// Names returns the names of all registered formats
+func Names() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the format with the given name
+func Get(name string) (WriteFunc, error) {
+	write, ok := formats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q, use one of %s", name, strings.Join(Names(), ", "))
+	}
+	return write, nil
+}
+
+// Write writes bookmarks in the named format
+func Write(w io.Writer, name string, bookmarks bookmark.Bookmarks, opts Options) error {
+	write, err := Get(name)
+	if err != nil {
+		return err
+	}
+	return write(w, bookmarks, opts)
+}
+
+func init() {
+	Register("json", writeJSON)
+	Register("ndjson", writeNDJSON)
+	Register("text", writeText)
+}
+
+// writeJSON writes all bookmarks as records in a versioned envelope
+func writeJSON(w io.Writer, bookmarks bookmark.Bookmarks, opts Options) error {
+	if err := checkFields(opts.Fields); err != nil {
+		return err
+	}
+
+	records := make([]json.RawMessage, len(bookmarks))
+	for i, bm := range bookmarks {
+		var err error
+		if records[i], err = marshalRecord(NewRecord(bm), opts.Fields); err != nil {
+			return err
+		}
+	}
+
+	envelope := struct {
+		SchemaVersion int               `json:"schema_version"`
+		Bookmarks     []json.RawMessage `json:"bookmarks"`
+	}{SchemaVersion, records}
+	data, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// writeNDJSON writes one record per line, so that consumers can process
+// bookmarks as they arrive. The records follow the same SchemaVersion as
+// the json format.
+func writeNDJSON(w io.Writer, bookmarks bookmark.Bookmarks, opts Options) error {
+	if err := checkFields(opts.Fields); err != nil {
+		return err
+	}
+
+	for _, bm := range bookmarks {
+		data, err := marshalRecord(NewRecord(bm), opts.Fields)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, string(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeText writes the title and URL of each bookmark separated by a tab
+func writeText(w io.Writer, bookmarks bookmark.Bookmarks, opts Options) error {
+	for _, bm := range bookmarks {
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", bm.Title, bm.URI); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultCSVFields are the CSV columns used when no fields are selected
+var DefaultCSVFields = []string{"title", "url", "folder", "tags", "sources", "added"}
+
+// folderNames splits a bookmark path into its folder names
+func folderNames(path string) []string {
+	var names []string
+	for _, name := range strings.Split(path, "/") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
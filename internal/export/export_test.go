@@ -0,0 +1,241 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zwo-bot/marks/bookmark"
+)
+
+// testBookmarks are the example of the README and one whose text needs
+// escaping in every format
+func testBookmarks() bookmark.Bookmarks {
+	return bookmark.Bookmarks{
+		{
+			Title:       "marks repo",
+			URI:         "https://github.com/zwo-bot/marks",
+			Domain:      "github.com",
+			Path:        "toolbar/Work/Infra",
+			Description: "Bookmark manager",
+			Tags:        []string{"go"},
+			Source:      "Firefox",
+			Sources:     []string{"Firefox", "Chrome"},
+			Profile:     "/home/me/.mozilla/firefox/abc.default-release",
+			Added:       time.Date(2026, 5, 28, 20, 26, 40, 0, time.UTC),
+			Frecency:    500,
+		},
+		{
+			Title:   `Say "hi", <world>`,
+			URI:     "https://example.com/a?b=1&c=2",
+			Domain:  "example.com",
+			Path:    "/",
+			Tags:    []string{"go tools", `q"t`},
+			Source:  "Chrome",
+			Profile: "Default",
+		},
+	}
+}
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		fields []string
+		want   string
+	}{
+		{"json", nil, `{
+  "schema_version": 1,
+  "bookmarks": [
+    {
+      "id": "6b2f2ceb523f",
+      "title": "marks repo",
+      "url": "https://github.com/zwo-bot/marks",
+      "domain": "github.com",
+      "folder": "toolbar/Work/Infra",
+      "description": "Bookmark manager",
+      "tags": [
+        "go"
+      ],
+      "sources": [
+        "Firefox",
+        "Chrome"
+      ],
+      "added": "2026-05-28T20:26:40Z",
+      "browser_frecency": 500
+    },
+    {
+      "id": "b44958853673",
+      "title": "Say \"hi\", \u003cworld\u003e",
+      "url": "https://example.com/a?b=1\u0026c=2",
+      "domain": "example.com",
+      "folder": "",
+      "description": "",
+      "tags": [
+        "go tools",
+        "q\"t"
+      ],
+      "sources": [
+        "Chrome"
+      ],
+      "added": null,
+      "browser_frecency": 0
+    }
+  ]
+}
+`},
+		{"json", []string{"url", "id"}, `{
+  "schema_version": 1,
+  "bookmarks": [
+    {
+      "url": "https://github.com/zwo-bot/marks",
+      "id": "6b2f2ceb523f"
+    },
+    {
+      "url": "https://example.com/a?b=1\u0026c=2",
+      "id": "b44958853673"
+    }
+  ]
+}
+`},
+		{"ndjson", nil, `{"id":"6b2f2ceb523f","title":"marks repo","url":"https://github.com/zwo-bot/marks","domain":"github.com","folder":"toolbar/Work/Infra","description":"Bookmark manager","tags":["go"],"sources":["Firefox","Chrome"],"added":"2026-05-28T20:26:40Z","browser_frecency":500}
+{"id":"b44958853673","title":"Say \"hi\", \u003cworld\u003e","url":"https://example.com/a?b=1\u0026c=2","domain":"example.com","folder":"","description":"","tags":["go tools","q\"t"],"sources":["Chrome"],"added":null,"browser_frecency":0}
+`},
+		{"ndjson", []string{"tags", "added"}, `{"tags":["go"],"added":"2026-05-28T20:26:40Z"}
+{"tags":["go tools","q\"t"],"added":null}
+`},
+		{"csv", nil, `title,url,folder,tags,sources,added
+marks repo,https://github.com/zwo-bot/marks,toolbar/Work/Infra,go,"Firefox,Chrome",2026-05-28T20:26:40Z
+"Say ""hi"", <world>",https://example.com/a?b=1&c=2,,"go tools,q""t",Chrome,
+`},
+		{"csv", []string{"added", "id", "browser_frecency", "tags"}, `added,id,browser_frecency,tags
+2026-05-28T20:26:40Z,6b2f2ceb523f,500,go
+,b44958853673,0,"go tools,q""t"
+`},
+		{"yaml", nil, `schema_version: 1
+bookmarks:
+  - id: "6b2f2ceb523f"
+    title: "marks repo"
+    url: "https://github.com/zwo-bot/marks"
+    domain: "github.com"
+    folder: "toolbar/Work/Infra"
+    description: "Bookmark manager"
+    tags:
+      - "go"
+    sources:
+      - "Firefox"
+      - "Chrome"
+    added: 2026-05-28T20:26:40Z
+    browser_frecency: 500
+  - id: "b44958853673"
+    title: "Say \"hi\", <world>"
+    url: "https://example.com/a?b=1&c=2"
+    domain: "example.com"
+    folder: ""
+    description: ""
+    tags:
+      - "go tools"
+      - "q\"t"
+    sources:
+      - "Chrome"
+    added: null
+    browser_frecency: 0
+`},
+		{"yaml", []string{"title", "sources"}, `schema_version: 1
+bookmarks:
+  - title: "marks repo"
+    sources:
+      - "Firefox"
+      - "Chrome"
+  - title: "Say \"hi\", <world>"
+    sources:
+      - "Chrome"
+`},
+		{"html", nil, `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file.
+     It will be read and overwritten.
+     DO NOT EDIT! -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3>toolbar</H3>
+    <DL><p>
+        <DT><H3>Work</H3>
+        <DL><p>
+            <DT><H3>Infra</H3>
+            <DL><p>
+                <DT><A HREF="https://github.com/zwo-bot/marks" ADD_DATE="1780000000" TAGS="go">marks repo</A>
+                <DD>Bookmark manager
+            </DL><p>
+        </DL><p>
+    </DL><p>
+    <DT><A HREF="https://example.com/a?b=1&amp;c=2" TAGS="go tools,q&#34;t">Say &#34;hi&#34;, &lt;world&gt;</A>
+</DL><p>
+`},
+		{"markdown", nil, "# Bookmarks\n" +
+			"\n" +
+			"- [Say \"hi\", <world>](<https://example.com/a?b=1&c=2>) `go tools` `q\"t`\n" +
+			"\n" +
+			"## toolbar\n" +
+			"\n" +
+			"### Work\n" +
+			"\n" +
+			"#### Infra\n" +
+			"\n" +
+			"- [marks repo](<https://github.com/zwo-bot/marks>) `go` — Bookmark manager\n"},
+		{"text", nil, "marks repo\thttps://github.com/zwo-bot/marks\n" +
+			"Say \"hi\", <world>\thttps://example.com/a?b=1&c=2\n"},
+	}
+	for _, tt := range tests {
+		name := tt.format
+		if tt.fields != nil {
+			name += " " + strings.Join(tt.fields, ",")
+		}
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Write(&out, tt.format, testBookmarks(), Options{Fields: tt.fields}); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatsWithoutBookmarks(t *testing.T) {
+	for format, want := range map[string]string{
+		"json":   "{\n  \"schema_version\": 1,\n  \"bookmarks\": []\n}\n",
+		"ndjson": "",
+		"csv":    "title,url,folder,tags,sources,added\n",
+		"yaml":   "schema_version: 1\nbookmarks: []\n",
+		"text":   "",
+	} {
+		var out bytes.Buffer
+		if err := Write(&out, format, nil, Options{}); err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		if got := out.String(); got != want {
+			t.Errorf("%s: got %q, want %q", format, got, want)
+		}
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	for _, format := range []string{"json", "ndjson", "csv", "yaml"} {
+		var out bytes.Buffer
+		err := Write(&out, format, testBookmarks(), Options{Fields: []string{"title", "icon"}})
+		if err == nil || !strings.Contains(err.Error(), `unknown field "icon"`) {
+			t.Errorf("%s: error = %v, want an unknown field error", format, err)
+		}
+		if out.Len() > 0 {
+			t.Errorf("%s: wrote %q before failing", format, out.String())
+		}
+	}
+
+	if err := Write(&bytes.Buffer{}, "xml", testBookmarks(), Options{}); err == nil {
+		t.Error("Write accepted an unknown format")
+	}
+}
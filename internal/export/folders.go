@@ -0,0 +1,36 @@
+package export
+
+import "github.com/zwo-bot/marks/bookmark"
+
+// folder is a node of the folder tree built from bookmark paths. Folders
+// and bookmarks keep the order in which they were first seen.
+type folder struct {
+	name      string
+	children  []*folder
+	bookmarks bookmark.Bookmarks
+}
+
+// folderTree groups bookmarks by their path
+func folderTree(bookmarks bookmark.Bookmarks) *folder {
+	root := &folder{}
+	for _, bm := range bookmarks {
+		node := root
+		for _, name := range folderNames(bm.Path) {
+			node = node.child(name)
+		}
+		node.bookmarks = append(node.bookmarks, bm)
+	}
+	return root
+}
+
+// child returns the subfolder with the given name, creating it if needed
+func (f *folder) child(name string) *folder {
+	for _, c := range f.children {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &folder{name: name}
+	f.children = append(f.children, c)
+	return c
+}
@@ -0,0 +1,52 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/zwo-bot/marks/bookmark"
+)
+
+func init() {
+	Register("markdown", writeMarkdown)
+}
+
+// markdownEscaper escapes the characters that end a link text
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`)
+
+// writeMarkdown writes a list of links per folder, with a heading per
+// folder whose level follows the folder depth
+func writeMarkdown(w io.Writer, bookmarks bookmark.Bookmarks, opts Options) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# Bookmarks")
+	writeMarkdownFolder(bw, folderTree(bookmarks), 1)
+	return bw.Flush()
+}
+
+func writeMarkdownFolder(w io.Writer, f *folder, level int) {
+	if len(f.bookmarks) > 0 {
+		fmt.Fprintln(w)
+	}
+	for _, bm := range f.bookmarks {
+		title := bm.Title
+		if title == "" {
+			title = bm.URI
+		}
+		line := fmt.Sprintf("- [%s](<%s>)", markdownEscaper.Replace(title), strings.ReplaceAll(bm.URI, ">", "%3E"))
+		if len(bm.Tags) > 0 {
+			line += " `" + strings.Join(bm.Tags, "` `") + "`"
+		}
+		if bm.Description != "" {
+			line += " — " + strings.Join(strings.Fields(bm.Description), " ")
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	for _, child := range f.children {
+		// Markdown has six heading levels; deeper folders stay at the last
+		fmt.Fprintf(w, "\n%s %s\n", strings.Repeat("#", min(level+1, 6)), child.name)
+		writeMarkdownFolder(w, child, level+1)
+	}
+}
@@ -0,0 +1,61 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/zwo-bot/marks/bookmark"
+)
+
+func init() {
+	Register("html", writeNetscape)
+}
+
+// writeNetscape writes the Netscape bookmark file format that all major
+// browsers import, with folders nested as in the bookmark paths
+func writeNetscape(w io.Writer, bookmarks bookmark.Bookmarks, opts Options) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file.
+     It will be read and overwritten.
+     DO NOT EDIT! -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+`)
+	writeNetscapeFolder(bw, folderTree(bookmarks), 0)
+	return bw.Flush()
+}
+
+func writeNetscapeFolder(w io.Writer, f *folder, depth int) {
+	indent := strings.Repeat("    ", depth)
+	fmt.Fprintf(w, "%s<DL><p>\n", indent)
+
+	for _, child := range f.children {
+		fmt.Fprintf(w, "%s    <DT><H3>%s</H3>\n", indent, html.EscapeString(child.name))
+		writeNetscapeFolder(w, child, depth+1)
+	}
+
+	for _, bm := range f.bookmarks {
+		attrs := fmt.Sprintf(` HREF="%s"`, html.EscapeString(bm.URI))
+		if !bm.Added.IsZero() {
+			attrs += fmt.Sprintf(` ADD_DATE="%d"`, bm.Added.Unix())
+		}
+		if len(bm.Tags) > 0 {
+			attrs += fmt.Sprintf(` TAGS="%s"`, html.EscapeString(strings.Join(bm.Tags, ",")))
+		}
+		title := bm.Title
+		if title == "" {
+			title = bm.URI
+		}
+		fmt.Fprintf(w, "%s    <DT><A%s>%s</A>\n", indent, attrs, html.EscapeString(title))
+		if bm.Description != "" {
+			fmt.Fprintf(w, "%s    <DD>%s\n", indent, html.EscapeString(bm.Description))
+		}
+	}
+
+	fmt.Fprintf(w, "%s</DL><p>\n", indent)
+}
@@ -0,0 +1,151 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zwo-bot/marks/bookmark"
+)
+
+// SchemaVersion is the version of the Record schema. It is increased
+// whenever a field is removed or changes its meaning; new fields may be
+// added without a new version.
+const SchemaVersion = 1
+
+// Record is a bookmark as written by the structured output formats. Its
+// fields are the documented schema and don't follow changes of
+// bookmark.Bookmark.
+type Record struct {
+	// ID identifies the bookmark by source, profile and URL, see
+	// bookmark.Bookmark.ID
+	ID              string     `json:"id"`
+	Title           string     `json:"title"`
+	URL             string     `json:"url"`
+	Domain          string     `json:"domain"`
+	Folder          string     `json:"folder"`
+	Description     string     `json:"description"`
+	Tags            []string   `json:"tags"`
+	Sources         []string   `json:"sources"`
+	Added           *time.Time `json:"added"`
+	BrowserFrecency int        `json:"browser_frecency"`
+}
+
+// NewRecord converts a bookmark to the output schema
+func NewRecord(bm bookmark.Bookmark) Record {
+	rec := Record{
+		ID:              bm.ID(),
+		Title:           bm.Title,
+		URL:             bm.URI,
+		Domain:          bm.Domain,
+		Folder:          strings.Trim(bm.Path, "/"),
+		Description:     bm.Description,
+		Tags:            bm.Tags,
+		Sources:         bm.AllSources(),
+		BrowserFrecency: bm.Frecency,
+	}
+	if rec.Tags == nil {
+		rec.Tags = []string{}
+	}
+	if rec.Sources == nil {
+		rec.Sources = []string{}
+	}
+	if !bm.Added.IsZero() {
+		added := bm.Added.UTC().Truncate(time.Second)
+		rec.Added = &added
+	}
+	return rec
+}
+
+// Fields are the names of the record fields in output order
+var Fields = []string{"id", "title", "url", "domain", "folder", "description", "tags", "sources", "added", "browser_frecency"}
+
+// field returns the value of a record field by its JSON name
+func (r Record) field(name string) (interface{}, error) {
+	switch name {
+	case "id":
+		return r.ID, nil
+	case "title":
+		return r.Title, nil
+	case "url":
+		return r.URL, nil
+	case "domain":
+		return r.Domain, nil
+	case "folder":
+		return r.Folder, nil
+	case "description":
+		return r.Description, nil
+	case "tags":
+		return r.Tags, nil
+	case "sources":
+		return r.Sources, nil
+	case "added":
+		return r.Added, nil
+	case "browser_frecency":
+		return r.BrowserFrecency, nil
+	}
+	return nil, fmt.Errorf("unknown field %q, use one of %s", name, strings.Join(Fields, ", "))
+}
+
+// checkFields fails on unknown field names
+func checkFields(fields []string) error {
+	for _, name := range fields {
+		if _, err := (Record{}).field(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalRecord encodes a record as a JSON object, limited to the given
+// fields in that order when any are selected
+func marshalRecord(r Record, fields []string) (json.RawMessage, error) {
+	if len(fields) == 0 {
+		return json.Marshal(r)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, name := range fields {
+		value, err := r.field(name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, "%q:", name)
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// fieldText returns a record field as text for column based formats
+func fieldText(r Record, name string) (string, error) {
+	value, err := r.field(name)
+	if err != nil {
+		return "", err
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []string:
+		return strings.Join(v, ","), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case *time.Time:
+		if v == nil {
+			return "", nil
+		}
+		return v.Format(time.RFC3339), nil
+	}
+	return fmt.Sprint(value), nil
+}
@@ -0,0 +1,83 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/zwo-bot/marks/bookmark"
+)
+
+func init() {
+	Register("yaml", writeYAML)
+}
+
+// writeYAML writes the records in the same envelope as the json format.
+// Strings are written as JSON strings, which are valid double-quoted YAML
+// scalars, so no escaping rules of plain YAML scalars apply.
+func writeYAML(w io.Writer, bookmarks bookmark.Bookmarks, opts Options) error {
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = Fields
+	}
+	if err := checkFields(fields); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "schema_version: %d\n", SchemaVersion)
+	if len(bookmarks) == 0 {
+		fmt.Fprintln(bw, "bookmarks: []")
+		return bw.Flush()
+	}
+
+	fmt.Fprintln(bw, "bookmarks:")
+	for _, bm := range bookmarks {
+		rec := NewRecord(bm)
+		for i, name := range fields {
+			prefix := "    "
+			if i == 0 {
+				prefix = "  - "
+			}
+			value, _ := rec.field(name)
+			fmt.Fprintf(bw, "%s%s:%s\n", prefix, name, yamlValue(value))
+		}
+	}
+	return bw.Flush()
+}
+
+// yamlValue formats a field value including the separating space, or a
+// block list for lists
+func yamlValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return " " + yamlString(v)
+	case []string:
+		if len(v) == 0 {
+			return " []"
+		}
+		var b strings.Builder
+		for _, item := range v {
+			b.WriteString("\n      - " + yamlString(item))
+		}
+		return b.String()
+	case *time.Time:
+		if v == nil {
+			return " null"
+		}
+		return " " + v.Format(time.RFC3339)
+	}
+	return fmt.Sprintf(" %v", value)
+}
+
+func yamlString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -13,26 +13,15 @@ import (
 
 // CacheDir returns the path to the favicon cache directory
 func CacheDir() (string, error) {
-	cacheHome := os.Getenv("XDG_CACHE_HOME")
-	if cacheHome == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", fmt.Errorf("could not get user home directory: %v", err)
-		}
-		cacheHome = filepath.Join(home, ".cache")
-	}
-
-	cacheDir := filepath.Join(cacheHome, "marks-favicons")
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		return "", fmt.Errorf("could not create cache directory: %v", err)
-	}
-
-	return cacheDir, nil
+	return db.CacheDir()
 }
 
 // SaveAndCacheIcon stores the icon in both the database and filesystem cache
 // Returns the path to the cached file for use with rofi
 func SaveAndCacheIcon(iconData []byte, urlStr string) (string, error) {
+	if db.ReadOnly() {
+		return "", db.ErrReadOnly
+	}
 	if len(iconData) == 0 {
 		return "", fmt.Errorf("no icon data provided")
 	}
@@ -67,8 +56,12 @@ func SaveAndCacheIcon(iconData []byte, urlStr string) (string, error) {
 	return iconPath, nil
 }
 
-// GetIconPath returns the filesystem path for a favicon, fetching from database if needed
+// GetIconPath returns the filesystem path for a favicon, fetching from database if needed.
+// In read-only mode there is none.
 func GetIconPath(urlStr string) (string, error) {
+	if db.ReadOnly() {
+		return "", nil
+	}
 	// Parse URL to get domain
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
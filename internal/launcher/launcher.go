@@ -0,0 +1,298 @@
+// Package launcher lets the user pick a bookmark with a menu program such
+// as dmenu, rofi, fuzzel, wofi, tofi, walker or fzf. Each launcher gets the
+// bookmarks on stdin in its own input format and prints the selection,
+// which is mapped back to the bookmark.
+package launcher
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/internal/logger"
+)
+
+// Launcher describes how to talk to a menu program
+type Launcher interface {
+	// Command returns the command line reading entries on stdin
+	Command(prompt string) []string
+	// Entry formats a bookmark as one input line; label is the text to show
+	Entry(index int, label string, bm bookmark.Bookmark) string
+	// Selection maps the launcher's output to the index of an entry, or -1
+	Selection(output string, entries []string) int
+}
+
+// launchers holds the supported launchers by name
+var launchers = map[string]Launcher{
+	"dmenu":  dmenu{},
+	"rofi":   rofi{},
+	"fuzzel": fuzzel{},
+	"wofi":   wofi{},
+	"tofi":   tofi{},
+	"walker": walker{},
+	"fzf":    fzf{},
+}
+
+// Names returns the names of the supported launchers
+func Names() []string {
+	names := make([]string, 0, len(launchers))
+	for name := range launchers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the launcher with the given name
+func Get(name string) (Launcher, error) {
+	l, ok := launchers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown launcher %q, use one of %s", name, strings.Join(Names(), ", "))
+	}
+	return l, nil
+}
+
+// Detect returns the name of an installed launcher suited to the session:
+// a Wayland or X11 launcher when a display is available, fzf otherwise
+func Detect() (string, error) {
+	var candidates []string
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		candidates = append(candidates, "fuzzel", "wofi", "tofi", "walker")
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" || os.Getenv("DISPLAY") != "" {
+		candidates = append(candidates, "rofi", "dmenu")
+	}
+	candidates = append(candidates, "fzf")
+
+	for _, name := range candidates {
+		if _, err := exec.LookPath(name); err == nil {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no launcher found, install one of %s", strings.Join(candidates, ", "))
+}
+
+// Pick shows bookmarks in the launcher and returns the selected one. It
+// returns nil if the user cancelled.
+func Pick(l Launcher, prompt string, bookmarks bookmark.Bookmarks, labels []string) (*bookmark.Bookmark, error) {
+	log := logger.GetLogger()
+
+	entries := menuEntries(l, bookmarks, labels)
+	var input bytes.Buffer
+	for _, entry := range entries {
+		input.WriteString(entry + "\n")
+	}
+
+	argv := l.Command(prompt)
+	log.Debug("Running launcher", "command", argv, "entries", len(entries))
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin = &input
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		// Launchers exit with 1 when cancelled, fzf with 130 on Esc
+		if exitErr, ok := err.(*exec.ExitError); ok && (exitErr.ExitCode() == 1 || exitErr.ExitCode() == 130) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error running %s: %v", argv[0], err)
+	}
+
+	index := l.Selection(strings.TrimRight(string(output), "\r\n"), entries)
+	if index < 0 || index >= len(bookmarks) {
+		log.Debug("Launcher selection doesn't match a bookmark", "output", string(output))
+		return nil, nil
+	}
+	return &bookmarks[index], nil
+}
+
+// menuEntries formats the input lines of the launcher. Repeated labels are
+// numbered, so that launchers printing the selected text still tell the
+// bookmarks apart.
+func menuEntries(l Launcher, bookmarks bookmark.Bookmarks, labels []string) []string {
+	entries := make([]string, len(bookmarks))
+	taken := make(map[string]bool, len(labels))
+	for i, bm := range bookmarks {
+		label := clean(labels[i])
+		unique := label
+		for n := 2; taken[unique]; n++ {
+			unique = fmt.Sprintf("%s (%d)", label, n)
+		}
+		taken[unique] = true
+		entries[i] = l.Entry(i, unique, bm)
+	}
+	return entries
+}
+
+// clean removes characters that would break the line based input formats
+func clean(text string) string {
+	return strings.NewReplacer("\n", " ", "\r", " ", "\t", " ", "\x00", "", "\x1f", "").Replace(text)
+}
+
+// matchLine returns the index of the entry equal to output, or -1
+func matchLine(output string, entries []string) int {
+	for i, entry := range entries {
+		if entry == output {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseIndex reads the index printed by launchers that support it
+func parseIndex(output string) int {
+	index, err := strconv.Atoi(strings.TrimSpace(output))
+	if err != nil {
+		return -1
+	}
+	return index
+}
+
+// iconOption appends the icon row option of rofi's format, which fuzzel
+// understands as well
+func iconOption(line string, bm bookmark.Bookmark) string {
+	if bm.Icon == "" {
+		return line
+	}
+	return line + "\x00icon\x1f" + bm.Icon
+}
+
+// dmenu shows plain text lines
+type dmenu struct{}
+
+func (dmenu) Command(prompt string) []string {
+	return []string{"dmenu", "-i", "-l", "20", "-p", prompt}
+}
+
+func (dmenu) Entry(index int, label string, bm bookmark.Bookmark) string {
+	return label
+}
+
+func (dmenu) Selection(output string, entries []string) int {
+	return matchLine(output, entries)
+}
+
+// rofi runs in dmenu mode, showing icons and printing the selected index
+type rofi struct{}
+
+func (rofi) Command(prompt string) []string {
+	return []string{"rofi", "-dmenu", "-i", "-show-icons", "-format", "i", "-p", prompt}
+}
+
+func (rofi) Entry(index int, label string, bm bookmark.Bookmark) string {
+	// Let rofi match the URL as well
+	line := label + "\x00meta\x1f" + clean(bm.URI)
+	if bm.Icon != "" {
+		line += "\x1ficon\x1f" + bm.Icon
+	}
+	return line
+}
+
+func (rofi) Selection(output string, entries []string) int {
+	return parseIndex(output)
+}
+
+// fuzzel understands rofi's icon option and can print the selected index
+type fuzzel struct{}
+
+func (fuzzel) Command(prompt string) []string {
+	return []string{"fuzzel", "--dmenu", "--index", "--prompt", prompt + ": "}
+}
+
+func (fuzzel) Entry(index int, label string, bm bookmark.Bookmark) string {
+	return iconOption(label, bm)
+}
+
+func (fuzzel) Selection(output string, entries []string) int {
+	return parseIndex(output)
+}
+
+// wofi shows icons with its img:<path>:text:<label> syntax
+type wofi struct{}
+
+func (wofi) Command(prompt string) []string {
+	return []string{"wofi", "--dmenu", "-i", "--allow-images", "--prompt", prompt}
+}
+
+func (wofi) Entry(index int, label string, bm bookmark.Bookmark) string {
+	if bm.Icon == "" || strings.Contains(bm.Icon, ":") {
+		return label
+	}
+	return "img:" + bm.Icon + ":text:" + label
+}
+
+func (wofi) Selection(output string, entries []string) int {
+	if index := matchLine(output, entries); index >= 0 {
+		return index
+	}
+	// Depending on the version wofi prints only the text of an image entry
+	for i, entry := range entries {
+		if _, text, ok := strings.Cut(entry, ":text:"); ok && strings.HasPrefix(entry, "img:") && text == output {
+			return i
+		}
+	}
+	return -1
+}
+
+// tofi shows plain text lines
+type tofi struct{}
+
+func (tofi) Command(prompt string) []string {
+	return []string{"tofi", "--prompt-text", prompt + ": "}
+}
+
+func (tofi) Entry(index int, label string, bm bookmark.Bookmark) string {
+	return label
+}
+
+func (tofi) Selection(output string, entries []string) int {
+	return matchLine(output, entries)
+}
+
+// walker shows plain text lines in its dmenu mode
+type walker struct{}
+
+func (walker) Command(prompt string) []string {
+	return []string{"walker", "--dmenu", "--placeholder", prompt}
+}
+
+func (walker) Entry(index int, label string, bm bookmark.Bookmark) string {
+	return label
+}
+
+func (walker) Selection(output string, entries []string) int {
+	return matchLine(output, entries)
+}
+
+// fzf runs in the terminal. Each line carries the index and the preview
+// fields separated by tabs; only the label is shown and searched.
+type fzf struct{}
+
+// fzfPreview prints the fields of the highlighted line; fzf quotes the
+// {N} placeholders for the shell
+const fzfPreview = `printf '%s\n\nURL:    %s\nFolder: %s\nTags:   %s\n\n%s\n' {2} {6} {3} {4} {5}`
+
+func (fzf) Command(prompt string) []string {
+	return []string{"fzf", "--delimiter", "\t", "--with-nth", "2",
+		"--prompt", prompt + "> ", "--preview", fzfPreview, "--preview-window", "down,7,wrap"}
+}
+
+func (fzf) Entry(index int, label string, bm bookmark.Bookmark) string {
+	return strings.Join([]string{
+		strconv.Itoa(index),
+		label,
+		clean(bm.Path),
+		clean(strings.Join(bm.Tags, ", ")),
+		clean(bm.Description),
+		clean(bm.URI),
+	}, "\t")
+}
+
+func (fzf) Selection(output string, entries []string) int {
+	field, _, _ := strings.Cut(output, "\t")
+	return parseIndex(field)
+}
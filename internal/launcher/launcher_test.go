@@ -0,0 +1,172 @@
+package launcher
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Initialize("error", "")
+	os.Exit(m.Run())
+}
+
+// testBookmarks has two bookmarks with the same title on the same site
+func testBookmarks() (bookmark.Bookmarks, []string) {
+	bms := bookmark.Bookmarks{
+		{Title: "Docs", URI: "https://example.com/v1", Path: "toolbar/Old", Icon: "/icons/example.png"},
+		{Title: "Docs", URI: "https://example.com/v2", Path: "toolbar", Tags: []string{"go", "ref"}, Description: "Current\tdocs"},
+		{Title: "News", URI: "https://news.example.com/"},
+	}
+	labels := []string{"Docs · example.com", "Docs · example.com", "News\n· news.example.com"}
+	return bms, labels
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		launcher string
+		want     []string
+	}{
+		{"dmenu", []string{"dmenu", "-i", "-l", "20", "-p", "Bookmarks"}},
+		{"rofi", []string{"rofi", "-dmenu", "-i", "-show-icons", "-format", "i", "-p", "Bookmarks"}},
+		{"fuzzel", []string{"fuzzel", "--dmenu", "--index", "--prompt", "Bookmarks: "}},
+		{"wofi", []string{"wofi", "--dmenu", "-i", "--allow-images", "--prompt", "Bookmarks"}},
+		{"tofi", []string{"tofi", "--prompt-text", "Bookmarks: "}},
+		{"walker", []string{"walker", "--dmenu", "--placeholder", "Bookmarks"}},
+		{"fzf", []string{"fzf", "--delimiter", "\t", "--with-nth", "2", "--prompt", "Bookmarks> ",
+			"--preview", fzfPreview, "--preview-window", "down,7,wrap"}},
+	}
+	for _, tt := range tests {
+		l, err := Get(tt.launcher)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", tt.launcher, err)
+		}
+		if got := l.Command("Bookmarks"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Command = %q, want %q", tt.launcher, got, tt.want)
+		}
+	}
+	if _, err := Get("zenity"); err == nil {
+		t.Error("Get accepted an unknown launcher")
+	}
+}
+
+func TestEntries(t *testing.T) {
+	bms, labels := testBookmarks()
+	tests := []struct {
+		launcher string
+		want     []string
+	}{
+		{"dmenu", []string{"Docs · example.com", "Docs · example.com (2)", "News · news.example.com"}},
+		{"rofi", []string{
+			"Docs · example.com\x00meta\x1fhttps://example.com/v1\x1ficon\x1f/icons/example.png",
+			"Docs · example.com (2)\x00meta\x1fhttps://example.com/v2",
+			"News · news.example.com\x00meta\x1fhttps://news.example.com/",
+		}},
+		{"fuzzel", []string{"Docs · example.com\x00icon\x1f/icons/example.png", "Docs · example.com (2)", "News · news.example.com"}},
+		{"wofi", []string{"img:/icons/example.png:text:Docs · example.com", "Docs · example.com (2)", "News · news.example.com"}},
+		{"fzf", []string{
+			"0\tDocs · example.com\ttoolbar/Old\t\t\thttps://example.com/v1",
+			"1\tDocs · example.com (2)\ttoolbar\tgo, ref\tCurrent docs\thttps://example.com/v2",
+			"2\tNews · news.example.com\t\t\t\thttps://news.example.com/",
+		}},
+	}
+	for _, tt := range tests {
+		l, _ := Get(tt.launcher)
+		if got := menuEntries(l, bms, labels); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: entries = %q, want %q", tt.launcher, got, tt.want)
+		}
+	}
+
+	// A label that looks numbered doesn't make another one ambiguous
+	l, _ := Get("dmenu")
+	got := menuEntries(l, make(bookmark.Bookmarks, 3), []string{"A", "A (2)", "A"})
+	if want := []string{"A", "A (2)", "A (3)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+}
+
+func TestSelection(t *testing.T) {
+	bms, labels := testBookmarks()
+	tests := []struct {
+		launcher string
+		// output is what the launcher prints when entry i is selected
+		output func(entries []string, i int) string
+	}{
+		{"dmenu", func(entries []string, i int) string { return entries[i] }},
+		{"tofi", func(entries []string, i int) string { return entries[i] }},
+		{"walker", func(entries []string, i int) string { return entries[i] }},
+		{"rofi", func(entries []string, i int) string { return strconv.Itoa(i) }},
+		{"fuzzel", func(entries []string, i int) string { return strconv.Itoa(i) }},
+		{"wofi", func(entries []string, i int) string { return entries[i] }},
+		// Some versions of wofi print only the text of an image entry
+		{"wofi", func(entries []string, i int) string {
+			_, text, found := strings.Cut(entries[i], ":text:")
+			if !found {
+				return entries[i]
+			}
+			return text
+		}},
+		{"fzf", func(entries []string, i int) string { return entries[i] }},
+	}
+	for _, tt := range tests {
+		l, _ := Get(tt.launcher)
+		entries := menuEntries(l, bms, labels)
+		for i := range entries {
+			output := tt.output(entries, i)
+			if got := l.Selection(output, entries); got != i {
+				t.Errorf("%s: Selection(%q) = %d, want %d", tt.launcher, output, got, i)
+			}
+		}
+		for _, output := range []string{"", "Docs", "not an entry"} {
+			if got := l.Selection(output, entries); got != -1 {
+				t.Errorf("%s: Selection(%q) = %d, want -1", tt.launcher, output, got)
+			}
+		}
+	}
+}
+
+// TestPick runs fake launchers that select the second of two bookmarks with
+// the same title
+func TestPick(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake launchers are shell scripts")
+	}
+	bin := t.TempDir()
+	for name, script := range map[string]string{
+		"dmenu":  "sed -n 2p",
+		"rofi":   "cat >/dev/null; echo 1",
+		"fzf":    "sed -n 2p",
+		"fuzzel": "cat >/dev/null; exit 1",
+	} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	bms, labels := testBookmarks()
+	for _, name := range []string{"dmenu", "rofi", "fzf"} {
+		l, _ := Get(name)
+		picked, err := Pick(l, "Bookmarks", bms, labels)
+		if err != nil {
+			t.Errorf("%s: Pick: %v", name, err)
+			continue
+		}
+		if picked == nil || picked.URI != "https://example.com/v2" {
+			t.Errorf("%s: Pick = %+v, want the second Docs", name, picked)
+		}
+	}
+
+	// Cancelling selects nothing
+	l, _ := Get("fuzzel")
+	if picked, err := Pick(l, "Bookmarks", bms, labels); picked != nil || err != nil {
+		t.Errorf("cancelled Pick = %+v, %v, want nil", picked, err)
+	}
+}
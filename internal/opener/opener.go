@@ -0,0 +1,303 @@
+// Package opener launches bookmarks. URLs matching a configured route are
+// opened with that route's command; otherwise bookmarks open in the browser
+// and profile they came from, chosen by the type of the plugin that read
+// them. If that browser is not available it falls back to the configured
+// default browser and finally to xdg-open.
+package opener
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/internal/config"
+	"github.com/zwo-bot/marks/internal/logger"
+	"gopkg.in/ini.v1"
+)
+
+// Options modify how a bookmark is opened
+type Options struct {
+	Private   bool // Open in a private/incognito window
+	NewWindow bool // Open in a new window instead of a tab
+}
+
+// browserFlags holds the command line flags of a browser family
+type browserFlags struct {
+	private   string
+	newWindow string
+}
+
+var (
+	firefoxFlags  = browserFlags{private: "--private-window", newWindow: "--new-window"}
+	chromiumFlags = browserFlags{private: "--incognito", newWindow: "--new-window"}
+)
+
+// knownBrowsers maps browser executables to their flags
+var knownBrowsers = map[string]browserFlags{
+	"firefox":               firefoxFlags,
+	"firefox-esr":           firefoxFlags,
+	"librewolf":             firefoxFlags,
+	"google-chrome":         chromiumFlags,
+	"google-chrome-stable":  chromiumFlags,
+	"chrome":                chromiumFlags,
+	"chromium":              chromiumFlags,
+	"chromium-browser":      chromiumFlags,
+	"brave":                 chromiumFlags,
+	"brave-browser":         chromiumFlags,
+	"vivaldi":               chromiumFlags,
+	"microsoft-edge":        {private: "--inprivate", newWindow: "--new-window"},
+	"microsoft-edge-stable": {private: "--inprivate", newWindow: "--new-window"},
+}
+
+// Open launches bm without waiting for the browser to exit
+func Open(bm bookmark.Bookmark, opts Options) error {
+	argv, err := Command(bm, opts)
+	if err != nil {
+		return err
+	}
+	logger.GetLogger().Debug("Opening bookmark", "uri", bm.URI, "command", argv)
+	return Start(argv)
+}
+
+// OpenAll launches several bookmarks. Bookmarks that open in the same
+// browser and profile are passed to one invocation of the browser, so with
+// NewWindow the first of them opens a new window and the rest open as tabs
+// in it. Routes and xdg-open get one invocation per bookmark.
+func OpenAll(bms bookmark.Bookmarks, opts Options) error {
+	var errs []error
+	var order []string
+	browsers := make(map[string][]string)
+
+	for _, bm := range bms {
+		argv, browser, err := command(bm, opts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", bm.URI, err))
+			continue
+		}
+		if !browser {
+			logger.GetLogger().Debug("Opening bookmark", "uri", bm.URI, "command", argv)
+			if err := Start(argv); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", bm.URI, err))
+			}
+			continue
+		}
+		// Browser command lines end with the URL
+		key := strings.Join(argv[:len(argv)-1], "\x00")
+		if _, ok := browsers[key]; ok {
+			browsers[key] = append(browsers[key], bm.URI)
+		} else {
+			order = append(order, key)
+			browsers[key] = argv
+		}
+	}
+
+	for _, key := range order {
+		argv := browsers[key]
+		logger.GetLogger().Debug("Opening bookmarks", "command", argv)
+		if err := Start(argv); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Start runs argv, such as a command line returned by Command, without
+// waiting for it to exit
+func Start(argv []string) error {
+	if len(argv) == 0 {
+		return fmt.Errorf("empty command")
+	}
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Env = os.Environ()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// Reap the browser when it exits
+	go cmd.Wait()
+	return nil
+}
+
+// Command returns the command line that opens bm
+func Command(bm bookmark.Bookmark, opts Options) ([]string, error) {
+	argv, _, err := command(bm, opts)
+	return argv, err
+}
+
+// command returns the command line that opens bm and whether it is a
+// browser's, which takes further URLs after the first
+func command(bm bookmark.Bookmark, opts Options) ([]string, bool, error) {
+	if bm.URI == "" {
+		return nil, false, fmt.Errorf("bookmark has no URL")
+	}
+
+	route, err := MatchRoute(bm.URI)
+	if err != nil {
+		return nil, false, err
+	}
+	if route >= 0 {
+		argv, err := routeCommand(config.GlobalConfig.Routes[route], bm.URI, opts)
+		return argv, false, err
+	}
+
+	if argv := sourceCommand(bm, opts); argv != nil {
+		return argv, true, nil
+	}
+	if argv := defaultBrowserCommand(bm.URI, opts); argv != nil {
+		return argv, true, nil
+	}
+	if opts.Private {
+		return nil, false, fmt.Errorf("no browser found to open a private window")
+	}
+	return []string{"xdg-open", bm.URI}, false, nil
+}
+
+// sourceCommand opens bm in the browser and profile it was read from. It
+// returns nil if the plugin type is unknown or its browser is not
+// installed.
+func sourceCommand(bm bookmark.Bookmark, opts Options) []string {
+	// Bookmarks cached before types were recorded only have the source,
+	// which is the type's name for unnamed instances
+	pluginType := bm.Type
+	if pluginType == "" {
+		pluginType = strings.ToLower(bm.Source)
+	}
+	switch pluginType {
+	case "firefox":
+		return firefoxCommand(bm.URI, bm.Profile, opts)
+	case "chrome":
+		return chromeCommand(bm.URI, bm.Profile, opts)
+	}
+	return nil
+}
+
+// firefoxCommand builds a Firefox command line for a profile directory,
+// selecting the profile by name from profiles.ini when possible
+func firefoxCommand(uri string, profileDir string, opts Options) []string {
+	var argv []string
+	switch {
+	case strings.Contains(profileDir, "/.var/app/org.mozilla.firefox/") && lookPath("flatpak"):
+		argv = []string{"flatpak", "run", "org.mozilla.firefox"}
+	case lookPath("firefox"):
+		argv = []string{"firefox"}
+	default:
+		return nil
+	}
+
+	if profileDir != "" {
+		if name := firefoxProfileName(profileDir); name != "" {
+			argv = append(argv, "-P", name)
+		} else {
+			argv = append(argv, "--profile", profileDir)
+		}
+	}
+	return append(argv, flagArgs(firefoxFlags, opts, uri)...)
+}
+
+// firefoxProfileName looks up the name of a profile directory in the
+// profiles.ini next to it
+func firefoxProfileName(profileDir string) string {
+	profileDir = filepath.Clean(profileDir)
+	base := filepath.Dir(profileDir)
+	cfg, err := ini.Load(filepath.Join(base, "profiles.ini"))
+	if err != nil {
+		return ""
+	}
+
+	for _, sec := range cfg.Sections() {
+		if !strings.HasPrefix(sec.Name(), "Profile") {
+			continue
+		}
+		path := sec.Key("Path").String()
+		if sec.Key("IsRelative").MustBool(true) {
+			path = filepath.Join(base, path)
+		}
+		if filepath.Clean(path) == profileDir {
+			return sec.Key("Name").String()
+		}
+	}
+	return ""
+}
+
+// chromeCommand builds a Chrome or Chromium command line for a profile
+// directory such as ~/.config/google-chrome/Profile 1
+func chromeCommand(uri string, profileDir string, opts Options) []string {
+	userDataDir := filepath.Dir(profileDir)
+
+	var argv []string
+	standard := false
+	switch {
+	case strings.Contains(profileDir, "/.var/app/com.google.Chrome/") && lookPath("flatpak"):
+		argv, standard = []string{"flatpak", "run", "com.google.Chrome"}, true
+	case strings.Contains(profileDir, "/.var/app/org.chromium.Chromium/") && lookPath("flatpak"):
+		argv, standard = []string{"flatpak", "run", "org.chromium.Chromium"}, true
+	case filepath.Base(userDataDir) == "chromium":
+		argv = firstInstalled("chromium", "chromium-browser")
+		standard = strings.HasSuffix(userDataDir, "/.config/chromium")
+	default:
+		argv = firstInstalled("google-chrome", "google-chrome-stable", "chromium", "chromium-browser")
+		standard = strings.HasSuffix(userDataDir, "/.config/google-chrome")
+	}
+	if argv == nil {
+		return nil
+	}
+
+	if profileDir != "" {
+		// The user data dir only needs to be given when it isn't the
+		// browser's default, e.g. for a snap or a custom location
+		if !standard {
+			argv = append(argv, "--user-data-dir="+userDataDir)
+		}
+		argv = append(argv, "--profile-directory="+filepath.Base(profileDir))
+	}
+	return append(argv, flagArgs(chromiumFlags, opts, uri)...)
+}
+
+// defaultBrowserCommand opens uri with the configured default browser. It
+// returns nil if none is configured or it is not installed.
+func defaultBrowserCommand(uri string, opts Options) []string {
+	fields := strings.Fields(config.GlobalConfig.DefaultBrowser)
+	if len(fields) == 0 || !lookPath(fields[0]) {
+		return nil
+	}
+
+	flags, known := knownBrowsers[filepath.Base(fields[0])]
+	if opts.Private && !known {
+		return nil
+	}
+	return append(fields, flagArgs(flags, opts, uri)...)
+}
+
+// flagArgs returns the window flags for opts followed by the URI
+func flagArgs(flags browserFlags, opts Options, uri string) []string {
+	return append(windowFlags(flags, opts), uri)
+}
+
+// windowFlags returns the flags selecting the window type for opts
+func windowFlags(flags browserFlags, opts Options) []string {
+	if opts.Private && flags.private != "" {
+		return []string{flags.private}
+	}
+	if opts.NewWindow && flags.newWindow != "" {
+		return []string{flags.newWindow}
+	}
+	return nil
+}
+
+// firstInstalled returns the first of the given executables found in PATH
+func firstInstalled(names ...string) []string {
+	for _, name := range names {
+		if lookPath(name) {
+			return []string{name}
+		}
+	}
+	return nil
+}
+
+func lookPath(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
@@ -0,0 +1,136 @@
+package opener
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/zwo-bot/marks/internal/config"
+)
+
+// MatchRoute returns the index of the first configured route matching uri,
+// or -1 if none matches
+func MatchRoute(uri string) (int, error) {
+	for i, route := range config.GlobalConfig.Routes {
+		ok, err := routeMatches(route, uri)
+		if err != nil {
+			return -1, fmt.Errorf("route %d: %v", i+1, err)
+		}
+		if ok {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+func routeMatches(route config.RouteConfig, uri string) (bool, error) {
+	if route.Command == "" {
+		return false, fmt.Errorf("no command")
+	}
+	if route.Match == "" && route.Regex == "" {
+		return false, fmt.Errorf("needs match or regex")
+	}
+
+	if route.Regex != "" {
+		re, err := regexp.Compile(route.Regex)
+		if err != nil {
+			return false, err
+		}
+		if !re.MatchString(uri) {
+			return false, nil
+		}
+	}
+
+	if route.Match != "" {
+		parsed, err := url.Parse(uri)
+		if err != nil {
+			return false, nil
+		}
+		host := strings.ToLower(parsed.Hostname())
+		pattern := strings.ToLower(route.Match)
+		if !strings.ContainsAny(pattern, "*?[") {
+			return host == pattern || strings.HasSuffix(host, "."+pattern), nil
+		}
+		ok, err := path.Match(pattern, host)
+		if err != nil {
+			return false, err
+		}
+		return ok, nil
+	}
+	return true, nil
+}
+
+// routeCommand expands a route's command template for uri. Window flags
+// are added when the command is a known browser.
+func routeCommand(route config.RouteConfig, uri string, opts Options) ([]string, error) {
+	fields, err := splitCommand(route.Command)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	var flags []string
+	if browser, known := knownBrowsers[filepath.Base(fields[0])]; known {
+		flags = windowFlags(browser, opts)
+	}
+
+	var argv []string
+	replaced := false
+	for _, field := range fields {
+		if strings.Contains(field, "%u") {
+			if !replaced {
+				argv = append(argv, flags...)
+			}
+			field = strings.ReplaceAll(field, "%u", uri)
+			replaced = true
+		}
+		argv = append(argv, field)
+	}
+	if !replaced {
+		argv = append(append(argv, flags...), uri)
+	}
+	return argv, nil
+}
+
+// splitCommand splits a command line into fields, honouring single and
+// double quotes so that arguments may contain spaces
+func splitCommand(command string) ([]string, error) {
+	var fields []string
+	var cur strings.Builder
+	var quote rune
+	inField := false
+
+	for _, r := range command {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inField = r, true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, cur.String())
+				cur.Reset()
+				inField = false
+			}
+		default:
+			cur.WriteRune(r)
+			inField = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", command)
+	}
+	if inField {
+		fields = append(fields, cur.String())
+	}
+	return fields, nil
+}
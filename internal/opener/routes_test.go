@@ -0,0 +1,148 @@
+package opener
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zwo-bot/marks/internal/config"
+)
+
+func TestRouteMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		route config.RouteConfig
+		uri   string
+		want  bool
+		err   bool
+	}{
+		{"domain", config.RouteConfig{Match: "example.com", Command: "b"}, "https://example.com/", true, false},
+		{"subdomain of domain", config.RouteConfig{Match: "example.com", Command: "b"}, "https://docs.example.com/a", true, false},
+		{"domain suffix is not a subdomain", config.RouteConfig{Match: "example.com", Command: "b"}, "https://notexample.com/", false, false},
+		{"other domain", config.RouteConfig{Match: "example.com", Command: "b"}, "https://example.org/", false, false},
+		{"domain ignores case", config.RouteConfig{Match: "Example.COM", Command: "b"}, "https://WWW.example.com/", true, false},
+		{"domain ignores port", config.RouteConfig{Match: "example.com", Command: "b"}, "http://example.com:8080/", true, false},
+		{"domain ignores path", config.RouteConfig{Match: "example.com", Command: "b"}, "https://other.org/example.com", false, false},
+		{"glob", config.RouteConfig{Match: "*.corp.example.com", Command: "b"}, "https://wiki.corp.example.com/", true, false},
+		{"glob needs a subdomain", config.RouteConfig{Match: "*.corp.example.com", Command: "b"}, "https://corp.example.com/", false, false},
+		{"glob star stays in one label", config.RouteConfig{Match: "*.example.com", Command: "b"}, "https://a.b.example.com/", true, false},
+		{"glob question mark", config.RouteConfig{Match: "host?.example.com", Command: "b"}, "https://host1.example.com/", true, false},
+		{"glob class", config.RouteConfig{Match: "[ab].example.com", Command: "b"}, "https://c.example.com/", false, false},
+		{"bad glob", config.RouteConfig{Match: "[.example.com", Command: "b"}, "https://a.example.com/", false, true},
+		{"regex", config.RouteConfig{Regex: `^https://github\.com/work/`, Command: "b"}, "https://github.com/work/repo", true, false},
+		{"regex mismatch", config.RouteConfig{Regex: `^https://github\.com/work/`, Command: "b"}, "https://github.com/home/repo", false, false},
+		{"regex and domain both match", config.RouteConfig{Match: "github.com", Regex: `/work/`, Command: "b"}, "https://github.com/work/repo", true, false},
+		{"regex matches but domain doesn't", config.RouteConfig{Match: "gitlab.com", Regex: `/work/`, Command: "b"}, "https://github.com/work/repo", false, false},
+		{"bad regex", config.RouteConfig{Regex: `(`, Command: "b"}, "https://example.com/", false, true},
+		{"no command", config.RouteConfig{Match: "example.com"}, "https://example.com/", false, true},
+		{"no match or regex", config.RouteConfig{Command: "b"}, "https://example.com/", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := routeMatches(tt.route, tt.uri)
+			if (err != nil) != tt.err {
+				t.Fatalf("routeMatches(%+v, %q) error = %v, want error %v", tt.route, tt.uri, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("routeMatches(%+v, %q) = %v, want %v", tt.route, tt.uri, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchRoute(t *testing.T) {
+	routes := config.GlobalConfig.Routes
+	t.Cleanup(func() { config.GlobalConfig.Routes = routes })
+
+	config.GlobalConfig.Routes = []config.RouteConfig{
+		{Match: "docs.example.com", Command: "first"},
+		{Match: "example.com", Command: "second"},
+		{Regex: "(", Command: "broken"},
+	}
+	for uri, want := range map[string]int{
+		"https://docs.example.com/": 0,
+		"https://www.example.com/":  1,
+	} {
+		if got, err := MatchRoute(uri); err != nil || got != want {
+			t.Errorf("MatchRoute(%q) = %d, %v, want %d", uri, got, err, want)
+		}
+	}
+	// The broken route is only reached if nothing before it matches
+	if got, err := MatchRoute("https://example.org/"); err == nil || got != -1 {
+		t.Errorf("MatchRoute with a bad regex = %d, %v, want -1 and an error", got, err)
+	}
+
+	config.GlobalConfig.Routes = nil
+	if got, err := MatchRoute("https://example.com/"); err != nil || got != -1 {
+		t.Errorf("MatchRoute without routes = %d, %v, want -1", got, err)
+	}
+}
+
+func TestRouteCommand(t *testing.T) {
+	const uri = "https://example.com/a b?q=1&r=2"
+	tests := []struct {
+		name    string
+		command string
+		opts    Options
+		want    []string
+	}{
+		{"url appended", "firefox -P work", Options{}, []string{"firefox", "-P", "work", uri}},
+		{"url replaced", "firefox -P work --new-tab %u", Options{}, []string{"firefox", "-P", "work", "--new-tab", uri}},
+		{"url inside a field", "open-in --url=%u", Options{}, []string{"open-in", "--url=" + uri}},
+		{"url twice", "echo %u %u", Options{}, []string{"echo", uri, uri}},
+		{"url in a quoted script", `sh -c 'xdg-open "%u"'`, Options{}, []string{"sh", "-c", `xdg-open "` + uri + `"`}},
+		{"quoted executable", `"/opt/My Browser/browser" --profile 'Work Profile'`, Options{}, []string{"/opt/My Browser/browser", "--profile", "Work Profile", uri}},
+		{"private window appended", "firefox -P work", Options{Private: true}, []string{"firefox", "-P", "work", "--private-window", uri}},
+		{"new window before the url", "chromium --profile-directory=Work %u", Options{NewWindow: true}, []string{"chromium", "--profile-directory=Work", "--new-window", uri}},
+		{"private beats new window", "brave %u", Options{Private: true, NewWindow: true}, []string{"brave", "--incognito", uri}},
+		{"known browser by path", "/usr/bin/microsoft-edge", Options{Private: true}, []string{"/usr/bin/microsoft-edge", "--inprivate", uri}},
+		{"unknown command gets no flags", "my-browser %u", Options{Private: true, NewWindow: true}, []string{"my-browser", uri}},
+		{"flags only before the first url", "firefox %u %u", Options{NewWindow: true}, []string{"firefox", "--new-window", uri, uri}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := routeCommand(config.RouteConfig{Match: "example.com", Command: tt.command}, uri, tt.opts)
+			if err != nil {
+				t.Fatalf("routeCommand(%q): %v", tt.command, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("routeCommand(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+
+	for _, command := range []string{"", "   ", `firefox 'unterminated`} {
+		if got, err := routeCommand(config.RouteConfig{Command: command}, uri, Options{}); err == nil {
+			t.Errorf("routeCommand(%q) = %q, want an error", command, got)
+		}
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+		err     bool
+	}{
+		{"", nil, false},
+		{"firefox", []string{"firefox"}, false},
+		{"  firefox \t -P  work ", []string{"firefox", "-P", "work"}, false},
+		{`"my browser" --flag`, []string{"my browser", "--flag"}, false},
+		{`browser 'single "double" inside'`, []string{"browser", `single "double" inside`}, false},
+		{`browser "double 'single' inside"`, []string{"browser", "double 'single' inside"}, false},
+		{`browser --name="a b"c`, []string{"browser", "--name=a bc"}, false},
+		{`browser "" last`, []string{"browser", "", "last"}, false},
+		{`browser ''`, []string{"browser", ""}, false},
+		{`browser "open`, nil, true},
+		{`browser 'open`, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := splitCommand(tt.command)
+		if (err != nil) != tt.err {
+			t.Errorf("splitCommand(%q) error = %v, want error %v", tt.command, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCommand(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+// Package query parses the bookmark filter language shared by the show,
+// rofi and search commands, e.g.
+//
+//	tag:go source:firefox domain:github.com folder:Work/Infra -tag:old is:dead added:<30d "exact phrase"
+//
+// Every term must match; a leading "-" negates a term. Words without a
+// known field prefix are matched against title, URL, path, description and
+// tags.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/zwo-bot/marks/bookmark"
+)
+
+// Fields understood by the parser. FieldText is used for plain words and
+// quoted phrases.
+const (
+	FieldText   = ""
+	FieldTag    = "tag"
+	FieldSource = "source"
+	FieldDomain = "domain"
+	FieldFolder = "folder"
+	FieldIs     = "is"
+	FieldAdded  = "added"
+)
+
+var knownFields = map[string]bool{
+	FieldTag:    true,
+	FieldSource: true,
+	FieldDomain: true,
+	FieldFolder: true,
+	FieldIs:     true,
+	FieldAdded:  true,
+}
+
+// Term is a single condition of a query
+type Term struct {
+	Field  string
+	Value  string
+	Negate bool
+	Phrase bool // Value was quoted and must match as a whole
+
+	// Set for FieldAdded terms: the bookmark must have been added
+	// after From and before To (either may be zero for an open range)
+	From time.Time
+	To   time.Time
+}
+
+// Query is a parsed filter expression. The zero value matches everything.
+type Query struct {
+	Terms []Term
+}
+
+// Parse parses a filter expression
+func Parse(s string) (*Query, error) {
+	now := time.Now()
+	q := &Query{}
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tok := range tokens {
+		term := Term{Value: tok.text, Phrase: tok.quoted}
+		if !tok.quoted && strings.HasPrefix(term.Value, "-") && len(term.Value) > 1 {
+			term.Negate = true
+			term.Value = term.Value[1:]
+		}
+
+		if !tok.quoted {
+			if field, value, ok := strings.Cut(term.Value, ":"); ok && knownFields[strings.ToLower(field)] {
+				term.Field = strings.ToLower(field)
+				term.Value = value
+				term.Phrase = tok.valueQuoted
+			}
+		}
+
+		if term.Field != FieldText && term.Value == "" {
+			return nil, fmt.Errorf("missing value for %s:", term.Field)
+		}
+
+		switch term.Field {
+		case FieldIs:
+			term.Value = strings.ToLower(term.Value)
+			if term.Value != "dead" {
+				return nil, fmt.Errorf("unknown condition is:%s (supported: dead)", term.Value)
+			}
+		case FieldAdded:
+			if term.From, term.To, err = parseAdded(term.Value, now); err != nil {
+				return nil, err
+			}
+		case FieldFolder:
+			term.Value = strings.Trim(term.Value, "/")
+		}
+
+		q.Terms = append(q.Terms, term)
+	}
+	return q, nil
+}
+
+type token struct {
+	text        string
+	quoted      bool // The whole token was quoted: "exact phrase"
+	valueQuoted bool // Only the value was quoted: folder:"My Stuff"
+}
+
+// tokenize splits s on whitespace, keeping quoted sections together
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	var cur strings.Builder
+	inQuote, quoted, started, quoteStart := false, false, false, 0
+
+	flush := func() {
+		if started {
+			tok := token{text: cur.String()}
+			if quoted {
+				// A quote at the start of the token quotes the whole term,
+				// a quote later on only quotes the value after "field:"
+				tok.quoted = quoteStart == 0
+				tok.valueQuoted = quoteStart > 0
+			}
+			tokens = append(tokens, tok)
+		}
+		cur.Reset()
+		inQuote, quoted, started = false, false, false
+	}
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			if !inQuote && !quoted {
+				quoteStart = cur.Len()
+			}
+			inQuote = !inQuote
+			quoted, started = true, true
+		case unicode.IsSpace(r) && !inQuote:
+			flush()
+		default:
+			cur.WriteRune(r)
+			started = true
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote in query %q", s)
+	}
+	flush()
+	return tokens, nil
+}
+
+// parseAdded parses the value of an added: term. A duration such as 30d,
+// 2w, 6m or 1y is an age ("<30d" = added in the last 30 days, ">1y" =
+// added more than a year ago); a date is YYYY-MM-DD ("<2024-01-01" =
+// before, ">2024-01-01" = after, no operator = on that day).
+func parseAdded(value string, now time.Time) (from, to time.Time, err error) {
+	op := ""
+	if strings.HasPrefix(value, "<") || strings.HasPrefix(value, ">") {
+		op, value = value[:1], value[1:]
+	}
+
+	if day, derr := time.ParseInLocation("2006-01-02", value, now.Location()); derr == nil {
+		switch op {
+		case "<":
+			return time.Time{}, day, nil
+		case ">":
+			return day.AddDate(0, 0, 1), time.Time{}, nil
+		default:
+			return day, day.AddDate(0, 0, 1), nil
+		}
+	}
+
+	age, err := parseAge(value)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid added:%s%s: %v", op, value, err)
+	}
+	cutoff := now.Add(-age)
+	if op == ">" {
+		return time.Time{}, cutoff, nil
+	}
+	return cutoff, time.Time{}, nil
+}
+
+// parseAge parses ages like 12h, 30d, 2w, 6m and 1y
+func parseAge(value string) (time.Duration, error) {
+	if len(value) < 2 {
+		return 0, fmt.Errorf("expected a number followed by h, d, w, m or y")
+	}
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a number followed by h, d, w, m or y")
+	}
+
+	day := 24 * time.Hour
+	units := map[byte]time.Duration{
+		'h': time.Hour,
+		'd': day,
+		'w': 7 * day,
+		'm': 30 * day,
+		'y': 365 * day,
+	}
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q, expected h, d, w, m or y", value[len(value)-1:])
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// IsEmpty reports whether the query has no terms
+func (q *Query) IsEmpty() bool {
+	return q == nil || len(q.Terms) == 0
+}
+
+// Match reports whether bm satisfies every term of the query
+func (q *Query) Match(bm bookmark.Bookmark) bool {
+	if q == nil {
+		return true
+	}
+	for _, t := range q.Terms {
+		if !t.Match(bm) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns the bookmarks matching the query. Dead link checks run
+// concurrently since each one is a network request.
+func (q *Query) Filter(bms bookmark.Bookmarks) bookmark.Bookmarks {
+	if q.IsEmpty() {
+		return bms
+	}
+
+	if !q.needsNetwork() {
+		var result bookmark.Bookmarks
+		for _, bm := range bms {
+			if q.Match(bm) {
+				result = append(result, bm)
+			}
+		}
+		return result
+	}
+
+	keep := make([]bool, len(bms))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 16)
+	for i, bm := range bms {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, bm bookmark.Bookmark) {
+			defer wg.Done()
+			keep[i] = q.Match(bm)
+			<-sem
+		}(i, bm)
+	}
+	wg.Wait()
+
+	var result bookmark.Bookmarks
+	for i, bm := range bms {
+		if keep[i] {
+			result = append(result, bm)
+		}
+	}
+	return result
+}
+
+// needsNetwork reports whether evaluating the query makes HTTP requests
+func (q *Query) needsNetwork() bool {
+	for _, t := range q.Terms {
+		if t.Field == FieldIs {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOffline returns an error if evaluating the query makes network
+// requests. Commands that run on every keystroke or menu call use it to
+// refuse is:dead, which would check every link each time.
+func (q *Query) CheckOffline() error {
+	if q.needsNetwork() {
+		return fmt.Errorf("is:dead checks every link and is only supported by show and search")
+	}
+	return nil
+}
+
+// Match reports whether bm satisfies the term
+func (t Term) Match(bm bookmark.Bookmark) bool {
+	return t.matches(bm) != t.Negate
+}
+
+func (t Term) matches(bm bookmark.Bookmark) bool {
+	value := strings.ToLower(t.Value)
+	switch t.Field {
+	case FieldTag:
+		for _, tag := range bm.Tags {
+			if strings.EqualFold(tag, t.Value) {
+				return true
+			}
+		}
+		return false
+	case FieldSource:
+		return strings.EqualFold(bm.Source, t.Value)
+	case FieldDomain:
+		domain := strings.ToLower(bm.Domain)
+		return domain == value || strings.HasSuffix(domain, "."+value)
+	case FieldFolder:
+		return strings.Contains(FolderKey(bm.Path), "/"+value+"/")
+	case FieldIs:
+		return !bm.URLIsValid()
+	case FieldAdded:
+		if bm.Added.IsZero() {
+			return false
+		}
+		return (t.From.IsZero() || !bm.Added.Before(t.From)) && (t.To.IsZero() || bm.Added.Before(t.To))
+	default:
+		for _, field := range append([]string{bm.Title, bm.URI, bm.Path, bm.Description}, bm.Tags...) {
+			if strings.Contains(strings.ToLower(field), value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FolderKey normalizes a bookmark path for folder: matching. The result
+// is lower case and wrapped in slashes, so "/work/infra/" is contained in
+// the key of every bookmark below a Work/Infra folder at any depth.
+func FolderKey(path string) string {
+	return "/" + strings.ToLower(strings.Trim(path, "/")) + "/"
+}
@@ -0,0 +1,184 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zwo-bot/marks/bookmark"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []Term
+	}{
+		{"", nil},
+		{"kube", []Term{{Value: "kube"}}},
+		{"-kube", []Term{{Value: "kube", Negate: true}}},
+		{`"exact phrase"`, []Term{{Value: "exact phrase", Phrase: true}}},
+		{`"-not negated"`, []Term{{Value: "-not negated", Phrase: true}}},
+		{"tag:go -tag:old", []Term{
+			{Field: FieldTag, Value: "go"},
+			{Field: FieldTag, Value: "old", Negate: true},
+		}},
+		{"TAG:Go", []Term{{Field: FieldTag, Value: "Go"}}},
+		{`folder:"My Stuff/Work/"`, []Term{{Field: FieldFolder, Value: "My Stuff/Work", Phrase: true}}},
+		{"source:firefox domain:github.com", []Term{
+			{Field: FieldSource, Value: "firefox"},
+			{Field: FieldDomain, Value: "github.com"},
+		}},
+		{"is:DEAD", []Term{{Field: FieldIs, Value: "dead"}}},
+		// Unknown fields are plain words
+		{"http://example.com", []Term{{Value: "http://example.com"}}},
+		{"a  b\tc", []Term{{Value: "a"}, {Value: "b"}, {Value: "c"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			q, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(q.Terms, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.input, q.Terms, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{
+		`"unterminated`,
+		"tag:",
+		"is:alive",
+		"added:",
+		"added:<30x",
+		"added:<d",
+		"added:>-1d",
+	} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", input)
+		}
+	}
+}
+
+func TestParseAdded(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		value    string
+		from, to time.Time
+	}{
+		{"<30d", now.AddDate(0, 0, -30), time.Time{}},
+		{"30d", now.AddDate(0, 0, -30), time.Time{}},
+		{">1y", time.Time{}, now.Add(-365 * 24 * time.Hour)},
+		{"<12h", now.Add(-12 * time.Hour), time.Time{}},
+		{"<2w", now.AddDate(0, 0, -14), time.Time{}},
+		{"2024-01-02", day(2024, 1, 2), day(2024, 1, 3)},
+		{"<2024-01-02", time.Time{}, day(2024, 1, 2)},
+		{">2024-01-02", day(2024, 1, 3), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		from, to, err := parseAdded(tt.value, now)
+		if err != nil {
+			t.Errorf("parseAdded(%q): %v", tt.value, err)
+			continue
+		}
+		if !from.Equal(tt.from) || !to.Equal(tt.to) {
+			t.Errorf("parseAdded(%q) = %v, %v, want %v, %v", tt.value, from, to, tt.from, tt.to)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	bm := bookmark.Bookmark{
+		Title:       "Kubernetes docs",
+		URI:         "https://kubernetes.io/docs/",
+		Path:        "toolbar/Work/Infra",
+		Description: "Container orchestration",
+		Domain:      "kubernetes.io",
+		Tags:        []string{"k8s", "Ops"},
+		Source:      "Firefox",
+		Added:       time.Now().AddDate(0, 0, -3),
+	}
+	undated := bm
+	undated.Added = time.Time{}
+
+	tests := []struct {
+		query string
+		bm    bookmark.Bookmark
+		want  bool
+	}{
+		{"", bm, true},
+		{"kube", bm, true},
+		{"KUBE", bm, true},
+		{"orchestration", bm, true},
+		{"infra", bm, true},
+		{"k8s", bm, true},
+		{"-kube", bm, false},
+		{"helm", bm, false},
+		{`"kubernetes docs"`, bm, true},
+		{`"docs kubernetes"`, bm, false},
+		{"tag:ops", bm, true},
+		{"tag:k8", bm, false},
+		{"-tag:old", bm, true},
+		{"source:firefox", bm, true},
+		{"source:chrome", bm, false},
+		{"domain:kubernetes.io", bm, true},
+		{"domain:io", bm, true},
+		{"domain:netes.io", bm, false},
+		{"folder:work", bm, true},
+		{"folder:Work/Infra", bm, true},
+		{"folder:/infra/", bm, true},
+		{"folder:Inf", bm, false},
+		{"folder:toolbar/Infra", bm, false},
+		{"added:<7d", bm, true},
+		{"added:>7d", bm, false},
+		{"added:<7d", undated, false},
+		{"-added:<7d", undated, true},
+		{"kube tag:ops source:firefox", bm, true},
+		{"kube tag:ops source:chrome", bm, false},
+	}
+
+	for _, tt := range tests {
+		q, err := Parse(tt.query)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.query, err)
+		}
+		if got := q.Match(tt.bm); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.query, tt.bm.Title, got, tt.want)
+		}
+	}
+}
+
+func TestCheckOffline(t *testing.T) {
+	for query, offline := range map[string]bool{
+		"kube tag:go": true,
+		"is:dead":     false,
+		"-is:dead":    false,
+	} {
+		q, err := Parse(query)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", query, err)
+		}
+		if err := q.CheckOffline(); (err == nil) != offline {
+			t.Errorf("CheckOffline(%q) = %v", query, err)
+		}
+	}
+}
+
+func TestFolderKey(t *testing.T) {
+	for path, want := range map[string]string{
+		"":                   "//",
+		"toolbar":            "/toolbar/",
+		"/Toolbar/Work/":     "/toolbar/work/",
+		"toolbar/Work/Infra": "/toolbar/work/infra/",
+	} {
+		if got := FolderKey(path); got != want {
+			t.Errorf("FolderKey(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
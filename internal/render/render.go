@@ -0,0 +1,161 @@
+// Package render formats bookmarks with user-defined text/template
+// templates. Templates get a bookmark.Bookmark as data and can use the
+// helper functions in Funcs, e.g.
+//
+//	{{ .Title | truncate 40 | pango }} <i>{{ domain .URI }}</i> {{ reldate .Added }}
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zwo-bot/marks/bookmark"
+)
+
+// Funcs are the helper functions available in templates
+var Funcs = template.FuncMap{
+	"pango":    Pango,
+	"shell":    Shell,
+	"json":     JSON,
+	"truncate": Truncate,
+	"domain":   Domain,
+	"reldate":  RelDate,
+	"date":     Date,
+	"join":     Join,
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+}
+
+// lineBreaks turns multi-line output into a single line
+var lineBreaks = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+// Template renders bookmarks
+type Template struct {
+	tmpl *template.Template
+}
+
+// Parse compiles a template
+func Parse(name string, text string) (*Template, error) {
+	tmpl, err := template.New(name).Funcs(Funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %v", name, err)
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+// Must is like Parse but panics if the template is invalid. It is meant
+// for built-in templates.
+func Must(name string, text string) *Template {
+	t, err := Parse(name, text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Render executes the template for one bookmark
+func (t *Template) Render(bm bookmark.Bookmark) (string, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, bm); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Line renders the template and joins the result into a single line, as
+// launchers read one entry per line. Surrounding whitespace is trimmed.
+func (t *Template) Line(bm bookmark.Bookmark) (string, error) {
+	text, err := t.Render(bm)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(lineBreaks.Replace(text)), nil
+}
+
+// Pango escapes text for Pango markup as used by rofi
+func Pango(text string) string {
+	text = strings.ReplaceAll(text, "&", "&amp;")
+	text = strings.ReplaceAll(text, "<", "&lt;")
+	return strings.ReplaceAll(text, ">", "&gt;")
+}
+
+// Shell quotes text as a single POSIX shell word
+func Shell(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+}
+
+// JSON encodes a value as JSON, e.g. a string including its quotes
+func JSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+// Truncate shortens text to at most n characters, ending in "…" when cut
+func Truncate(n int, text string) string {
+	if n <= 0 || utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:n-1]) + "…"
+}
+
+// Domain returns the host of a URL without a leading "www."
+func Domain(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(parsed.Hostname(), "www.")
+}
+
+// RelDate describes a time relative to now, e.g. "3 days ago"
+func RelDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	age := time.Since(t)
+	if age < 0 {
+		return "in the future"
+	}
+
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"week", 7 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	for _, unit := range units {
+		if n := int(age / unit.size); n >= 1 {
+			if n == 1 {
+				return "1 " + unit.name + " ago"
+			}
+			return fmt.Sprintf("%d %ss ago", n, unit.name)
+		}
+	}
+	return "just now"
+}
+
+// Date formats a time with a Go layout, returning "" for the zero time
+func Date(layout string, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(layout)
+}
+
+// Join joins a list with a separator: {{ join ", " .Tags }}
+func Join(sep string, list []string) string {
+	return strings.Join(list, sep)
+}
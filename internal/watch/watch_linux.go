@@ -0,0 +1,89 @@
+package watch
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// events are the inotify events that can mean a watched file changed.
+// Files replaced by renaming show up as IN_MOVED_TO in their directory.
+const events = syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_CREATE |
+	syscall.IN_MOVED_TO | syscall.IN_DELETE
+
+// Watcher reports changes of files through inotify. It watches the
+// directories of the files rather than the files themselves, so that it
+// keeps following files that are replaced or created later.
+type Watcher struct {
+	fd    int
+	dirs  map[int32]string
+	files map[string]bool
+}
+
+// New returns a watcher without files
+func New() (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize inotify: %v", err)
+	}
+	return &Watcher{fd: fd, dirs: make(map[int32]string), files: make(map[string]bool)}, nil
+}
+
+// Add watches path, which need not exist yet. Its directory must exist.
+func (w *Watcher) Add(path string) error {
+	path = filepath.Clean(path)
+	dir := filepath.Dir(path)
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, events)
+	if err != nil {
+		return fmt.Errorf("could not watch %s: %v", dir, err)
+	}
+	w.dirs[int32(wd)] = dir
+	w.files[path] = true
+	return nil
+}
+
+// Run sends the path of every changed file to changes until reading events
+// fails. A file that is changed a lot is sent a lot; callers debounce.
+func (w *Watcher) Run(changes chan<- string) error {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := syscall.Read(w.fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("could not read inotify events: %v", err)
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			offset = nameStart + int(event.Len)
+
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				// Events were lost, so any file may have changed
+				for path := range w.files {
+					changes <- path
+				}
+				continue
+			}
+			if event.Len == 0 {
+				continue
+			}
+			name := string(buf[nameStart:offset])
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1]
+			}
+			path := filepath.Join(w.dirs[event.Wd], name)
+			if w.files[path] {
+				changes <- path
+			}
+		}
+	}
+}
+
+// Close stops watching
+func (w *Watcher) Close() error {
+	return syscall.Close(w.fd)
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package watch
+
+import "errors"
+
+// Watcher reports changes of files. It needs inotify and is only
+// available on Linux.
+type Watcher struct{}
+
+// New fails on this platform
+func New() (*Watcher, error) {
+	return nil, errors.New("watching files needs inotify, which is only available on Linux")
+}
+
+func (w *Watcher) Add(path string) error {
+	return nil
+}
+
+func (w *Watcher) Run(changes chan<- string) error {
+	return nil
+}
+
+func (w *Watcher) Close() error {
+	return nil
+}
@@ -0,0 +1,41 @@
+// Package xdg locates the directories marks keeps its files in, following
+// the XDG base directory specification
+package xdg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DataDir returns the directory for the database, $XDG_DATA_HOME/marks or
+// ~/.local/share/marks, creating it if needed
+func DataDir() (string, error) {
+	return appDir("XDG_DATA_HOME", ".local/share")
+}
+
+// CacheDir returns the directory for files that can be recreated,
+// $XDG_CACHE_HOME/marks or ~/.cache/marks, creating it if needed
+func CacheDir() (string, error) {
+	return appDir("XDG_CACHE_HOME", ".cache")
+}
+
+// appDir returns the marks directory in the base directory named by env,
+// or in the fallback below the home directory if env is not set
+func appDir(env string, fallback string) (string, error) {
+	base := os.Getenv(env)
+	// Relative paths are invalid according to the specification
+	if !filepath.IsAbs(base) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not get user home directory: %v", err)
+		}
+		base = filepath.Join(home, fallback)
+	}
+
+	dir := filepath.Join(base, "marks")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("could not create directory: %v", err)
+	}
+	return dir, nil
+}
@@ -1,6 +1,7 @@
 package chrome
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -9,6 +10,8 @@ import (
 	neturl "net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/zwo-bot/marks/bookmark"
@@ -48,21 +51,19 @@ func (c *ChromePlugin) SetConfig(cc interfaces.PluginConfig) {
 	c.Config = cc
 }
 
-func (c *ChromePlugin) GetBookmarks() bookmark.Bookmarks {
+func (c *ChromePlugin) GetBookmarks(ctx context.Context) (bookmark.Bookmarks, error) {
 	var bookmarks bookmark.Bookmarks
 	log := logger.GetLogger()
 	log.With("plugin", c.GetName())
 
 	chromeConfig, ok := c.Config.(*ChromeConfig)
 	if !ok {
-		log.Error("Configuration is not of type *ChromeConfig")
-		return bookmark.Bookmarks{}
+		return nil, fmt.Errorf("configuration is of type %T, not *ChromeConfig", c.Config)
 	}
 
 	err := chromeConfig.Load()
 	if err != nil {
-		log.Error("Error loading configuration", "error", err)
-		return bookmark.Bookmarks{}
+		return nil, fmt.Errorf("error loading configuration: %v", err)
 	}
 
 	profileDir := filepath.Dir(chromeConfig.ProfilePath) // Get the profile directory
@@ -72,34 +73,41 @@ func (c *ChromePlugin) GetBookmarks() bookmark.Bookmarks {
 	// Read bookmarks file
 	data, err := os.ReadFile(bookmarksPath)
 	if err != nil {
-		log.Error("Chrome bookmarks file not found", "path", bookmarksPath, "error", err)
-		return bookmark.Bookmarks{}
+		return nil, fmt.Errorf("error reading bookmarks file: %v", err)
 	}
 
 	var chromeBookmarks ChromeBookmarks
 	if err := json.Unmarshal(data, &chromeBookmarks); err != nil {
-		log.Error("Error parsing bookmarks file", "error", err)
-		return bookmark.Bookmarks{}
+		return nil, fmt.Errorf("error parsing bookmarks file %s: %v", bookmarksPath, err)
 	}
 
 	// Process each root folder
 	for folder, root := range chromeBookmarks.Roots {
-		bookmarks = append(bookmarks, processBookmarks(root, folder, profileDir, log)...)
+		bookmarks = append(bookmarks, processBookmarks(ctx, root, folder, profileDir, log)...)
+	}
+	// processBookmarks stops early when ctx is done
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	return bookmarks
+	return bookmarks, nil
 }
 
-func processBookmarks(node ChromeBookmark, path string, profilePath string, log *slog.Logger) bookmark.Bookmarks {
+func processBookmarks(ctx context.Context, node ChromeBookmark, path string, profilePath string, log *slog.Logger) bookmark.Bookmarks {
 	var bookmarks bookmark.Bookmarks
+	if ctx.Err() != nil {
+		return nil
+	}
 
 	// If it's a URL bookmark, add it
 	if node.Type == "url" {
 		bookmark := bookmark.Bookmark{
-			Title:  node.Name,
-			URI:    node.URL,
-			Path:   path,
-			Source: "Chrome",
+			Title:   node.Name,
+			URI:     node.URL,
+			Path:    path,
+			Source:  "Chrome",
+			Profile: profilePath,
+			Added:   chromeTime(node.DateAdded),
 		}
 
 		// Parse URL to get domain
@@ -142,12 +150,24 @@ func processBookmarks(node ChromeBookmark, path string, profilePath string, log
 				newPath = filepath.Join(newPath, child.Name)
 			}
 		}
-		bookmarks = append(bookmarks, processBookmarks(child, newPath, profilePath, log)...)
+		bookmarks = append(bookmarks, processBookmarks(ctx, child, newPath, profilePath, log)...)
 	}
 
 	return bookmarks
 }
 
+// chromeTime converts a Chrome timestamp (microseconds since 1601-01-01 UTC)
+// to a time.Time, returning the zero time for missing or invalid values
+func chromeTime(value string) time.Time {
+	usec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || usec <= 0 {
+		return time.Time{}
+	}
+	// Seconds between the Windows epoch (1601) and the Unix epoch (1970)
+	const epochDelta = 11644473600
+	return time.Unix(usec/1e6-epochDelta, (usec%1e6)*1e3).UTC()
+}
+
 func copyAndOpenDB(sourcePath string, prefix string) (*sql.DB, error) {
 	source, err := os.Open(sourcePath)
 	if err != nil {
@@ -248,3 +268,47 @@ func getFaviconFromChrome(profilePath string, url string, log *slog.Logger) ([]b
 	}
 	return iconData, err
 }
+
+// Fingerprint returns the checksum Chrome stores in the bookmarks file, or
+// its modification time and size if there is none
+func (c *ChromePlugin) Fingerprint() (string, error) {
+	chromeConfig, ok := c.Config.(*ChromeConfig)
+	if !ok {
+		return "", fmt.Errorf("configuration is not of type *ChromeConfig")
+	}
+	if err := chromeConfig.Load(); err != nil {
+		return "", err
+	}
+
+	bookmarksPath := filepath.Join(filepath.Dir(chromeConfig.ProfilePath), "Bookmarks")
+	data, err := os.ReadFile(bookmarksPath)
+	if err != nil {
+		return "", err
+	}
+
+	var header struct {
+		Checksum string `json:"checksum"`
+	}
+	if err := json.Unmarshal(data, &header); err == nil && header.Checksum != "" {
+		return bookmarksPath + "|checksum:" + header.Checksum, nil
+	}
+
+	info, err := os.Stat(bookmarksPath)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s|stat:%d:%d", bookmarksPath, info.ModTime().UnixNano(), info.Size()), nil
+}
+
+// WatchPaths returns the bookmarks file. Chrome replaces it on every change.
+func (c *ChromePlugin) WatchPaths() ([]string, error) {
+	chromeConfig, ok := c.Config.(*ChromeConfig)
+	if !ok {
+		return nil, fmt.Errorf("configuration is not of type *ChromeConfig")
+	}
+	if err := chromeConfig.Load(); err != nil {
+		return nil, err
+	}
+
+	return []string{filepath.Join(filepath.Dir(chromeConfig.ProfilePath), "Bookmarks")}, nil
+}
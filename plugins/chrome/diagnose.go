@@ -0,0 +1,92 @@
+package chrome
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/zwo-bot/marks/plugins/interfaces"
+)
+
+// supportedVersion is the version of the bookmarks file marks reads
+const supportedVersion = 1
+
+// Diagnose checks the bookmarks file and the Favicons database of the
+// profile
+func (c *ChromePlugin) Diagnose(ctx context.Context) interfaces.Diagnosis {
+	d := interfaces.Diagnosis{Favicons: -1}
+
+	chromeConfig, ok := c.Config.(*ChromeConfig)
+	if !ok {
+		d.Problems = append(d.Problems, "configuration is not of type *ChromeConfig")
+		return d
+	}
+	if err := chromeConfig.Load(); err != nil {
+		d.Problems = append(d.Problems, fmt.Sprintf("no profile found: %v", err))
+		return d
+	}
+	d.Profile = filepath.Dir(chromeConfig.ProfilePath)
+
+	bookmarks := interfaces.CheckFile(filepath.Join(d.Profile, "Bookmarks"))
+	favicons := interfaces.CheckFile(filepath.Join(d.Profile, "Favicons"))
+	d.Files = []interfaces.FileStatus{bookmarks, favicons}
+
+	if !bookmarks.Readable {
+		d.Problems = append(d.Problems, "the Bookmarks file can't be read")
+	} else if version, err := bookmarksVersion(bookmarks.Path); err != nil {
+		d.Problems = append(d.Problems, fmt.Sprintf("the Bookmarks file is not supported: %v", err))
+	} else {
+		d.Schema = fmt.Sprintf("Bookmarks file version %d", version)
+		if version > supportedVersion {
+			d.Warnings = append(d.Warnings, fmt.Sprintf("marks knows Bookmarks file version %d, bookmarks may be missing", supportedVersion))
+		}
+	}
+
+	if !favicons.Readable {
+		d.Warnings = append(d.Warnings, "the Favicons database can't be read, bookmarks get no icons from Chrome")
+	} else if count, err := countFavicons(ctx, favicons.Path); err != nil {
+		d.Warnings = append(d.Warnings, fmt.Sprintf("the Favicons database can't be read: %v", err))
+	} else {
+		d.Favicons = count
+	}
+	return d
+}
+
+// bookmarksVersion returns the version of a bookmarks file and fails if
+// it has no bookmark roots
+func bookmarksVersion(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var header struct {
+		Version int                       `json:"version"`
+		Roots   map[string]ChromeBookmark `json:"roots"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, err
+	}
+	if len(header.Roots) == 0 {
+		return header.Version, fmt.Errorf("no bookmark roots")
+	}
+	return header.Version, nil
+}
+
+// countFavicons returns the number of favicons in the Favicons database,
+// which is read in place
+func countFavicons(ctx context.Context, path string) (int, error) {
+	dsn := (&neturl.URL{Scheme: "file", Path: path, RawQuery: "mode=ro&_busy_timeout=100"}).String()
+	sqlDB, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return 0, err
+	}
+	defer sqlDB.Close()
+
+	var count int
+	err = sqlDB.QueryRowContext(ctx, "SELECT count(*) FROM favicons").Scan(&count)
+	return count, err
+}
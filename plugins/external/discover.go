@@ -0,0 +1,75 @@
+package external
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/internal/xdg"
+	"github.com/zwo-bot/marks/plugins/interfaces"
+	"github.com/zwo-bot/marks/plugins/registry"
+)
+
+// Prefix starts the names of external plugin executables
+const Prefix = "marks-plugin-"
+
+// Dir returns the plugins directory, $XDG_DATA_HOME/marks/plugins
+func Dir() (string, error) {
+	dir, err := xdg.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "plugins"), nil
+}
+
+// Discover returns the external plugin executables by plugin name. The
+// plugins directory is searched before $PATH; the first executable of a
+// name wins.
+func Discover() map[string]string {
+	var dirs []string
+	if dir, err := Dir(); err == nil {
+		dirs = append(dirs, dir)
+	}
+	dirs = append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+
+	found := make(map[string]string)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutPrefix(entry.Name(), Prefix)
+			if !ok || name == "" {
+				continue
+			}
+			if _, ok := found[name]; ok {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			// Follows symlinks, which entry doesn't
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+				continue
+			}
+			found[name] = path
+		}
+	}
+	return found
+}
+
+// Register registers the discovered external plugins. Built-in plugins
+// take precedence over external ones of the same name.
+func Register() {
+	log := logger.GetLogger()
+	for name, path := range Discover() {
+		log.Debug("Found external plugin", "name", name, "path", path)
+		registry.Register(name, func(config interface{}) (interfaces.Plugin, error) {
+			return New(name, path, config)
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/plugins/interfaces"
+)
+
+// describeTimeout limits the describe call made when the plugin is created
+const describeTimeout = 5 * time.Second
+
+// ExternalPlugin runs an external plugin executable
+type ExternalPlugin struct {
+	Config interfaces.PluginConfig
+	// Path is the executable
+	Path        string
+	name        string
+	description string
+	methods     []string
+}
+
+// ExternalConfig passes the plugin's configuration through to it
+type ExternalConfig struct {
+	Settings interface{}
+}
+
+// Load does nothing; the plugin interprets its configuration itself
+func (c *ExternalConfig) Load() error {
+	return nil
+}
+
+// Save does nothing; the configuration is only read
+func (c *ExternalConfig) Save() error {
+	return nil
+}
+
+// New creates the plugin for the executable at path and asks it to
+// describe itself. name is used as the source if the plugin gives none.
+func New(name string, path string, config interface{}) (*ExternalPlugin, error) {
+	p := &ExternalPlugin{Config: &ExternalConfig{Settings: config}, Path: path, name: name}
+
+	ctx, cancel := context.WithTimeout(context.Background(), describeTimeout)
+	defer cancel()
+	resp, err := p.call(ctx, Request{Method: MethodDescribe})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Name != "" {
+		p.name = resp.Name
+	}
+	p.description = resp.Description
+	p.methods = resp.Methods
+	return p, nil
+}
+
+func (p *ExternalPlugin) GetName() string {
+	return p.name
+}
+
+func (p *ExternalPlugin) GetConfig() interfaces.PluginConfig {
+	return p.Config
+}
+
+func (p *ExternalPlugin) SetConfig(config interfaces.PluginConfig) {
+	p.Config = config
+}
+
+// Description returns what the plugin said about itself
+func (p *ExternalPlugin) Description() string {
+	return p.description
+}
+
+func (p *ExternalPlugin) GetBookmarks(ctx context.Context) (bookmark.Bookmarks, error) {
+	resp, err := p.call(ctx, Request{Method: MethodGetBookmarks})
+	if err != nil {
+		return nil, err
+	}
+
+	bookmarks := make(bookmark.Bookmarks, 0, len(resp.Bookmarks))
+	for _, b := range resp.Bookmarks {
+		if b.URL == "" {
+			logger.GetLogger().Debug("Skipping bookmark without URL", "plugin", p.name, "title", b.Title)
+			continue
+		}
+		bm := bookmark.Bookmark{
+			Title:       b.Title,
+			URI:         b.URL,
+			Path:        b.Path,
+			Description: b.Description,
+			Tags:        b.Tags,
+			Keyword:     b.Keyword,
+			Icon:        b.Icon,
+			Source:      p.name,
+			Profile:     b.Profile,
+		}
+		if bm.Title == "" {
+			bm.Title = b.URL
+		}
+		if b.Added != nil {
+			bm.Added = b.Added.UTC()
+		}
+		if parsedURL, err := neturl.Parse(b.URL); err == nil {
+			bm.Domain = parsedURL.Host
+		}
+		bookmarks = append(bookmarks, bm)
+	}
+	return bookmarks, nil
+}
+
+// DeleteBookmark deletes bm at its source. It fails with
+// errors.ErrUnsupported if the plugin doesn't support deleting.
+func (p *ExternalPlugin) DeleteBookmark(ctx context.Context, bm bookmark.Bookmark) error {
+	if !slices.Contains(p.methods, MethodDeleteBookmark) {
+		return fmt.Errorf("%s: deleting bookmarks: %w", p.name, errors.ErrUnsupported)
+	}
+	_, err := p.call(ctx, Request{Method: MethodDeleteBookmark, Bookmark: newBookmark(bm)})
+	return err
+}
+
+// Diagnose reports the executable and the methods it supports
+func (p *ExternalPlugin) Diagnose(ctx context.Context) interfaces.Diagnosis {
+	d := interfaces.Diagnosis{
+		Files:    []interfaces.FileStatus{interfaces.CheckFile(p.Path)},
+		Schema:   fmt.Sprintf("protocol version %d", ProtocolVersion),
+		Favicons: -1,
+	}
+	if len(p.methods) > 0 {
+		d.Schema += ", supports " + strings.Join(p.methods, ", ")
+	}
+	return d
+}
+
+// call runs the executable with req on its stdin and reads the response.
+// The executable is killed when ctx is done.
+func (p *ExternalPlugin) call(ctx context.Context, req Request) (*Response, error) {
+	log := logger.GetLogger().With("plugin", p.name)
+
+	req.Protocol = ProtocolVersion
+	if config, ok := p.Config.(*ExternalConfig); ok {
+		req.Config = config.Settings
+	}
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Path)
+	cmd.Stdin = bytes.NewReader(append(input, '\n'))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait for children that keep the output open after a kill
+	cmd.WaitDelay = time.Second
+
+	log.Debug("Calling external plugin", "path", p.Path, "method", req.Method)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if message := lastLine(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%s %s failed: %v: %s", p.Path, req.Method, err, message)
+		}
+		return nil, fmt.Errorf("%s %s failed: %v", p.Path, req.Method, err)
+	}
+	if stderr.Len() > 0 {
+		log.Debug("External plugin wrote to stderr", "method", req.Method, "stderr", strings.TrimSpace(stderr.String()))
+	}
+
+	var resp Response
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("invalid response of %s to %s: %v", p.Path, req.Method, err)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// lastLine returns the last non-empty line of s, which usually holds the
+// error message of a failed program
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,84 @@
+// Package external runs plugins that are separate executables. An external
+// plugin is an executable named marks-plugin-<name> on $PATH or in the
+// plugins directory. marks starts it once per call, writes one JSON request
+// to its stdin and reads one JSON response from its stdout.
+package external
+
+import (
+	"time"
+
+	"github.com/zwo-bot/marks/bookmark"
+)
+
+// ProtocolVersion is sent with every request. Plugins should reject
+// requests of a version they don't know.
+const ProtocolVersion = 1
+
+// Methods of the protocol
+const (
+	// MethodDescribe asks for the plugin's name and the methods it supports
+	MethodDescribe = "describe"
+	// MethodGetBookmarks asks for all bookmarks
+	MethodGetBookmarks = "get-bookmarks"
+	// MethodDeleteBookmark deletes a bookmark at its source. Plugins
+	// support it optionally.
+	MethodDeleteBookmark = "delete-bookmark"
+)
+
+// Request is written to the plugin's stdin
+type Request struct {
+	Protocol int    `json:"protocol"`
+	Method   string `json:"method"`
+	// Config is the plugin's entry in the plugins section of the marks
+	// configuration, null if there is none
+	Config interface{} `json:"config"`
+	// Bookmark is the bookmark to delete for delete-bookmark
+	Bookmark *Bookmark `json:"bookmark,omitempty"`
+}
+
+// Response is read from the plugin's stdout. Error is set if the request
+// failed.
+type Response struct {
+	Error string `json:"error,omitempty"`
+	// Name is the source shown for the bookmarks (describe)
+	Name string `json:"name,omitempty"`
+	// Description is shown by list-plugins (describe)
+	Description string `json:"description,omitempty"`
+	// Methods lists the optional methods the plugin supports (describe)
+	Methods []string `json:"methods,omitempty"`
+	// Bookmarks are the plugin's bookmarks (get-bookmarks)
+	Bookmarks []Bookmark `json:"bookmarks,omitempty"`
+}
+
+// Bookmark is a bookmark as plugins send it. Only URL is required.
+type Bookmark struct {
+	Title       string     `json:"title"`
+	URL         string     `json:"url"`
+	Path        string     `json:"path,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Keyword     string     `json:"keyword,omitempty"`
+	Added       *time.Time `json:"added,omitempty"`
+	// Icon is the path of an image file
+	Icon string `json:"icon,omitempty"`
+	// Profile distinguishes bookmarks of several accounts or instances
+	Profile string `json:"profile,omitempty"`
+}
+
+// newBookmark converts a bookmark for a request
+func newBookmark(bm bookmark.Bookmark) *Bookmark {
+	b := &Bookmark{
+		Title:       bm.Title,
+		URL:         bm.URI,
+		Path:        bm.Path,
+		Description: bm.Description,
+		Tags:        bm.Tags,
+		Keyword:     bm.Keyword,
+		Icon:        bm.Icon,
+		Profile:     bm.Profile,
+	}
+	if !bm.Added.IsZero() {
+		b.Added = &bm.Added
+	}
+	return b
+}
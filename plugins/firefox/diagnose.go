@@ -0,0 +1,95 @@
+package firefox
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/zwo-bot/marks/plugins/interfaces"
+)
+
+// Diagnose checks places.sqlite and favicons.sqlite of the profile. They
+// are read in place, so a running Firefox may keep them locked.
+func (fp *FirefoxPlugin) Diagnose(ctx context.Context) interfaces.Diagnosis {
+	d := interfaces.Diagnosis{Favicons: -1}
+
+	firefoxConfig, ok := fp.GetConfig().(*FirefoxConfig)
+	if !ok {
+		d.Problems = append(d.Problems, "configuration is not of type *FirefoxConfig")
+		return d
+	}
+	if err := firefoxConfig.Load(); err != nil {
+		d.Problems = append(d.Problems, fmt.Sprintf("no profile found: %v", err))
+		return d
+	}
+	d.Profile = firefoxConfig.ProfilePath
+
+	places := interfaces.CheckFile(filepath.Join(d.Profile, "places.sqlite"))
+	favicons := interfaces.CheckFile(filepath.Join(d.Profile, "favicons.sqlite"))
+	d.Files = []interfaces.FileStatus{places, favicons}
+
+	if !places.Readable {
+		d.Problems = append(d.Problems, "places.sqlite can't be read")
+	} else if version, err := placesSchema(ctx, places.Path); isLocked(err) {
+		d.Warnings = append(d.Warnings, "places.sqlite is locked, its schema was not checked")
+	} else if err != nil {
+		d.Problems = append(d.Problems, fmt.Sprintf("places.sqlite is not supported: %v", err))
+	} else {
+		d.Schema = fmt.Sprintf("places.sqlite schema version %d", version)
+	}
+
+	if !favicons.Readable {
+		d.Warnings = append(d.Warnings, "favicons.sqlite can't be read, bookmarks get no icons from Firefox")
+	} else if count, err := countIcons(ctx, favicons.Path); err != nil {
+		d.Warnings = append(d.Warnings, fmt.Sprintf("favicons.sqlite can't be read: %v", err))
+	} else {
+		d.Favicons = count
+	}
+	return d
+}
+
+// placesSchema returns the schema version of places.sqlite and fails if
+// the tables and columns marks reads are missing
+func placesSchema(ctx context.Context, path string) (int, error) {
+	sqlDB, err := openInPlace(path)
+	if err != nil {
+		return 0, err
+	}
+	defer sqlDB.Close()
+
+	var version int
+	if err := sqlDB.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	rows, err := sqlDB.QueryContext(ctx, `SELECT b.id, b.parent, b.type, b.title, b.dateAdded, b.lastModified,
+       p.url, p.description, p.frecency, k.keyword
+FROM moz_bookmarks b
+JOIN moz_places p ON b.fk = p.id
+LEFT JOIN moz_keywords k ON k.place_id = p.id
+LIMIT 0`)
+	if err != nil {
+		return version, err
+	}
+	rows.Close()
+	return version, nil
+}
+
+// countIcons returns the number of icons in favicons.sqlite
+func countIcons(ctx context.Context, path string) (int, error) {
+	sqlDB, err := openInPlace(path)
+	if err != nil {
+		return 0, err
+	}
+	defer sqlDB.Close()
+
+	var count int
+	err = sqlDB.QueryRowContext(ctx, "SELECT count(*) FROM moz_icons").Scan(&count)
+	return count, err
+}
+
+// isLocked reports whether err is SQLite's "database is locked". The error
+// text is matched because the driver's error types only exist with cgo.
+func isLocked(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "database is locked")
+}
@@ -1,12 +1,15 @@
 package firefox
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/zwo-bot/marks/bookmark"
@@ -15,8 +18,6 @@ import (
 	"github.com/zwo-bot/marks/plugins/interfaces"
 )
 
-var mozBookmarks []mozBookmark
-
 type FirefoxPlugin struct {
 	Config interfaces.PluginConfig
 }
@@ -30,6 +31,9 @@ type mozBookmark struct {
 	Url         sql.NullString
 	IconPath    sql.NullString
 	Tags        sql.NullString
+	DateAdded   sql.NullInt64
+	Frecency    sql.NullInt64
+	Keyword     sql.NullString
 }
 
 func (fp *FirefoxPlugin) GetName() string {
@@ -44,7 +48,7 @@ func (fp *FirefoxPlugin) SetConfig(fc interfaces.PluginConfig) {
 	fp.Config = fc
 }
 
-func (fp *FirefoxPlugin) GetBookmarks() bookmark.Bookmarks {
+func (fp *FirefoxPlugin) GetBookmarks(ctx context.Context) (bookmark.Bookmarks, error) {
 	var bookmarks bookmark.Bookmarks
 
 	log := logger.GetLogger()
@@ -57,25 +61,21 @@ func (fp *FirefoxPlugin) GetBookmarks() bookmark.Bookmarks {
 
 	firefoxConfig, ok := fpConfig.(*FirefoxConfig)
 	if !ok {
-		// Handle the error or unexpected type
-		log.Error("Configuration is not of type *FirefoxConfig")
-		return bookmark.Bookmarks{}
+		return nil, fmt.Errorf("configuration is of type %T, not *FirefoxConfig", fpConfig)
 	}
 	log.Debug("Firefox config before Load()", "profile_path", firefoxConfig.ProfilePath)
 
 	err := firefoxConfig.Load()
 	if err != nil {
-		log.Error("Error loading configuration", "error", err)
-		return bookmark.Bookmarks{}
+		return nil, fmt.Errorf("error loading configuration: %v", err)
 	}
 	log.Debug("Firefox config after Load()", "profile_path", firefoxConfig.ProfilePath)
 
 	// Get bookmarks from the configured profile path
-	moz_bookmarks, err := getMozBookmarks(firefoxConfig.ProfilePath)
+	moz_bookmarks, folders, err := getMozBookmarks(ctx, firefoxConfig.ProfilePath)
 	if err != nil {
-		log.Debug("Could not get Firefox bookmarks", "error", err)
 		log.Debug("Failed at getMozBookmarks", "profile_path", firefoxConfig.ProfilePath)
-		return bookmark.Bookmarks{}
+		return nil, err
 	}
 	log.Debug("Retrieved Mozilla bookmarks", "count", len(moz_bookmarks))
 
@@ -101,6 +101,19 @@ func (fp *FirefoxPlugin) GetBookmarks() bookmark.Bookmarks {
 			bookmark.Description = mozBookmark.Description.String
 		}
 
+		if mozBookmark.Frecency.Valid {
+			bookmark.Frecency = int(mozBookmark.Frecency.Int64)
+		}
+
+		if mozBookmark.Keyword.Valid {
+			bookmark.Keyword = mozBookmark.Keyword.String
+		}
+
+		// Firefox stores dateAdded as microseconds since the Unix epoch
+		if mozBookmark.DateAdded.Valid && mozBookmark.DateAdded.Int64 > 0 {
+			bookmark.Added = time.UnixMicro(mozBookmark.DateAdded.Int64).UTC()
+		}
+
 		// Process tags if available
 		if mozBookmark.Tags.Valid && mozBookmark.Tags.String != "" {
 			// Split tags string into slice and trim whitespace
@@ -113,8 +126,9 @@ func (fp *FirefoxPlugin) GetBookmarks() bookmark.Bookmarks {
 			}
 		}
 
-		bookmark.Path = getPath(mozBookmark)
+		bookmark.Path = folders.path(mozBookmark)
 		bookmark.Source = fp.GetName()
+		bookmark.Profile = firefoxConfig.ProfilePath
 
 		if has_url {
 			// Get favicon from Firefox's database and store it
@@ -132,38 +146,27 @@ func (fp *FirefoxPlugin) GetBookmarks() bookmark.Bookmarks {
 		}
 	}
 
-	return bookmarks
+	return bookmarks, nil
 }
 
-func getMozBookmarks(profile_path string) ([]mozBookmark, error) {
+func getMozBookmarks(ctx context.Context, profile_path string) ([]mozBookmark, mozFolders, error) {
 	log := logger.GetLogger()
 	log.Debug("Starting getMozBookmarks", "profile_path", profile_path)
 
-	// Check if places.sqlite exists
-	placesPath := profile_path + "/places.sqlite"
-	log.Debug("Opening places.sqlite", "path", placesPath)
-	source, err := os.Open(placesPath)
-	if err != nil {
-		log.Debug("Failed to open places.sqlite", "error", err)
-		return nil, err
-	}
-	defer source.Close()
-
 	// Create temporary copy of places.sqlite
-	dst, err := os.CreateTemp("", "ff_places")
+	placesPath := profile_path + "/places.sqlite"
+	log.Debug("Copying places.sqlite", "path", placesPath)
+	copyPath, removeCopy, err := copyProfileDB(placesPath, "ff_places")
 	if err != nil {
-		return nil, fmt.Errorf("error creating temp file: %v", err)
-	}
-	defer os.Remove(dst.Name())
-
-	if _, err := io.Copy(dst, source); err != nil {
-		return nil, fmt.Errorf("error copying database: %v", err)
+		log.Debug("Failed to copy places.sqlite", "error", err)
+		return nil, nil, err
 	}
+	defer removeCopy()
 
 	// Open database connection
-	sqlDB, err := sql.Open("sqlite3", dst.Name())
+	sqlDB, err := sql.Open("sqlite3", copyPath)
 	if err != nil {
-		return nil, fmt.Errorf("error opening database: %v", err)
+		return nil, nil, fmt.Errorf("error opening database: %v", err)
 	}
 	defer sqlDB.Close()
 
@@ -191,18 +194,22 @@ SELECT
     b.title,
     p.url,
     p.description,
-    btl.tags
+    btl.tags,
+    b.dateAdded,
+    p.frecency,
+    k.keyword
 FROM moz_bookmarks b
 LEFT JOIN moz_places p ON b.fk = p.id
 LEFT JOIN bookmark_tag_links btl ON p.id = btl.place_id
+LEFT JOIN moz_keywords k ON k.place_id = p.id
 WHERE b.type = 1  -- Only regular bookmarks
   AND b.title IS NOT NULL  -- Skip tag link entries`
 
 	log.Debug("Executing SQL query", "query", sqlStmt)
-	rows, err := sqlDB.Query(sqlStmt)
+	rows, err := sqlDB.QueryContext(ctx, sqlStmt)
 	if err != nil {
 		log.Debug("SQL query failed", "error", err)
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
@@ -211,7 +218,7 @@ WHERE b.type = 1  -- Only regular bookmarks
 	for rows.Next() {
 		rowCount++
 		var row mozBookmark
-		err = rows.Scan(&row.Id, &row.Parent, &row.Typ, &row.Title, &row.Url, &row.Description, &row.Tags)
+		err = rows.Scan(&row.Id, &row.Parent, &row.Typ, &row.Title, &row.Url, &row.Description, &row.Tags, &row.DateAdded, &row.Frecency, &row.Keyword)
 		if err != nil {
 			log.Error("Error scanning row", "error", err)
 			continue
@@ -219,20 +226,32 @@ WHERE b.type = 1  -- Only regular bookmarks
 		bookmarks = append(bookmarks, row)
 		log.Debug("Processed bookmark row", "id", row.Id, "title", row.Title, "url", row.Url)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
 	log.Debug("Finished processing rows", "total_rows", rowCount, "valid_bookmarks", len(bookmarks))
 
+	// Folders are needed to resolve bookmark paths
+	folders, err := getMozFolders(sqlDB)
+	if err != nil {
+		log.Debug("Could not get Firefox folders", "error", err)
+	}
+
 	// Get favicons
-	faviconsDB, err := copyAndOpenDB(profile_path+"/favicons.sqlite", "ff_favicons")
+	faviconsDB, closeFavicons, err := copyAndOpenDB(profile_path+"/favicons.sqlite", "ff_favicons")
 	if err != nil {
 		log.Error("Error opening favicons database", "error", err)
-		return bookmarks, nil // Return bookmarks without icons
+		return bookmarks, folders, nil // Return bookmarks without icons
 	}
-	defer faviconsDB.Close()
+	defer closeFavicons()
 
 	log.Debug("Successfully opened favicons.sqlite", "path", profile_path+"/favicons.sqlite")
 
 	// Add icons to bookmarks
 	for i, bookmark := range bookmarks {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
 		if bookmark.Url.Valid {
 			log.Debug("Getting favicon for URL", "url", bookmark.Url.String)
 			iconData, err := getFavicon(faviconsDB, bookmark.Url.String)
@@ -255,50 +274,103 @@ WHERE b.type = 1  -- Only regular bookmarks
 		}
 	}
 
-	mozBookmarks = bookmarks
-	return bookmarks, nil
+	return bookmarks, folders, nil
 }
 
-func copyAndOpenDB(sourcePath string, prefix string) (*sql.DB, error) {
-	log := logger.GetLogger()
-	log.Debug("Starting database copy operation", "source", sourcePath)
+// mozFolders are the bookmark folders of places.sqlite by id
+type mozFolders map[int]mozBookmark
 
-	source, err := os.Open(sourcePath)
+// getMozFolders returns all bookmark folders (type 2) of places.sqlite
+func getMozFolders(sqlDB *sql.DB) (mozFolders, error) {
+	rows, err := sqlDB.Query("SELECT id, parent, type, title FROM moz_bookmarks WHERE type = 2")
 	if err != nil {
-		log.Debug("Failed to open source database", "error", err)
 		return nil, err
 	}
-	defer source.Close()
+	defer rows.Close()
+
+	folders := make(mozFolders)
+	for rows.Next() {
+		var row mozBookmark
+		if err := rows.Scan(&row.Id, &row.Parent, &row.Typ, &row.Title); err != nil {
+			return nil, err
+		}
+		folders[row.Id] = row
+	}
+	return folders, rows.Err()
+}
 
-	dst, err := os.CreateTemp("", prefix)
+// copyProfileDB copies a database of the profile together with its
+// write-ahead log into a new temporary directory, so that it can be read
+// while Firefox has it open. The log holds what Firefox wrote since its last
+// checkpoint, such as new bookmarks; the fingerprint, which reads the
+// database in place, sees it too. The log is copied first: a checkpoint in
+// between only moves its pages into the database, which then reads the
+// same. The wal-index (-shm) describes Firefox's open log and isn't copied;
+// SQLite rebuilds it from the copied log. The returned function removes the
+// copy.
+func copyProfileDB(sourcePath string, prefix string) (string, func(), error) {
+	dir, err := os.MkdirTemp("", prefix)
 	if err != nil {
-		log.Debug("Failed to create temp file", "error", err)
-		return nil, fmt.Errorf("error creating temp file: %v", err)
+		return "", nil, fmt.Errorf("error creating temp directory: %v", err)
 	}
-	defer os.Remove(dst.Name())
+	remove := func() { os.RemoveAll(dir) }
 
-	if _, err := io.Copy(dst, source); err != nil {
-		log.Debug("Failed to copy database", "error", err)
-		return nil, fmt.Errorf("error copying database: %v", err)
+	copyPath := filepath.Join(dir, filepath.Base(sourcePath))
+	if err := copyFile(sourcePath+"-wal", copyPath+"-wal"); err != nil && !os.IsNotExist(err) {
+		remove()
+		return "", nil, fmt.Errorf("error copying write-ahead log: %v", err)
+	}
+	if err := copyFile(sourcePath, copyPath); err != nil {
+		remove()
+		if os.IsNotExist(err) {
+			return "", nil, err
+		}
+		return "", nil, fmt.Errorf("error copying database: %v", err)
 	}
+	return copyPath, remove, nil
+}
 
-	// Ensure all writes are flushed to disk
-	if err := dst.Sync(); err != nil {
-		log.Debug("Failed to sync database file", "error", err)
-		return nil, fmt.Errorf("error syncing database: %v", err)
+// copyFile copies src to the new file dst
+func copyFile(src string, dst string) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return err
 	}
+	defer source.Close()
 
-	// Close the file to ensure all writes are complete
-	if err := dst.Close(); err != nil {
-		log.Debug("Failed to close database file", "error", err)
-		return nil, fmt.Errorf("error closing database: %v", err)
+	target, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close()
+		return err
 	}
+	return target.Close()
+}
 
-	log.Debug("Opening copied database", "path", dst.Name())
-	db, err := sql.Open("sqlite3", dst.Name())
+// copyAndOpenDB opens a copy of a database of the profile. The returned
+// function closes it and removes the copy.
+func copyAndOpenDB(sourcePath string, prefix string) (*sql.DB, func(), error) {
+	log := logger.GetLogger()
+	log.Debug("Starting database copy operation", "source", sourcePath)
+
+	copyPath, removeCopy, err := copyProfileDB(sourcePath, prefix)
+	if err != nil {
+		log.Debug("Failed to copy database", "error", err)
+		return nil, nil, err
+	}
+
+	log.Debug("Opening copied database", "path", copyPath)
+	db, err := sql.Open("sqlite3", copyPath)
 	if err != nil {
 		log.Debug("Failed to open database", "error", err)
-		return nil, err
+		removeCopy()
+		return nil, nil, err
+	}
+	closeCopy := func() {
+		db.Close()
+		removeCopy()
 	}
 
 	// Initialize the database connection with proper settings
@@ -312,8 +384,8 @@ func copyAndOpenDB(sourcePath string, prefix string) (*sql.DB, error) {
 	for _, pragma := range pragmas {
 		if _, err := db.Exec(pragma); err != nil {
 			log.Debug("Failed to set pragma", "pragma", pragma, "error", err)
-			db.Close()
-			return nil, fmt.Errorf("error setting pragma %s: %v", pragma, err)
+			closeCopy()
+			return nil, nil, fmt.Errorf("error setting pragma %s: %v", pragma, err)
 		}
 	}
 
@@ -322,17 +394,17 @@ func copyAndOpenDB(sourcePath string, prefix string) (*sql.DB, error) {
 	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='moz_pages_w_icons'").Scan(&tableCount)
 	if err != nil {
 		log.Debug("Failed to verify tables", "error", err)
-		db.Close()
-		return nil, fmt.Errorf("error verifying tables: %v", err)
+		closeCopy()
+		return nil, nil, fmt.Errorf("error verifying tables: %v", err)
 	}
 	if tableCount == 0 {
 		log.Debug("Required table not found in copied database", "table", "moz_pages_w_icons")
-		db.Close()
-		return nil, fmt.Errorf("required table moz_pages_w_icons not found")
+		closeCopy()
+		return nil, nil, fmt.Errorf("required table moz_pages_w_icons not found")
 	}
 
 	log.Debug("Successfully initialized database connection")
-	return db, nil
+	return db, closeCopy, nil
 }
 
 func getFavicon(sqlDB *sql.DB, url string) ([]byte, error) {
@@ -432,27 +504,90 @@ func getFaviconAlternative(sqlDB *sql.DB, url string) ([]byte, error) {
 	return nil, nil
 }
 
-func getById(id int) mozBookmark {
-	result := mozBookmark{}
-
-	for _, b := range mozBookmarks {
-		if id == b.Id {
-			result = b
-			break
-		}
-	}
-	return result
-}
-
-func getPath(mb mozBookmark) string {
-	rec := getById(mb.Id)
-	parent_id := rec.Parent
+// path returns the folders containing mb, separated by slashes
+func (f mozFolders) path(mb mozBookmark) string {
+	parent_id := mb.Parent
 	path := ""
 
 	for parent_id > 1 {
-		parent := getById(parent_id)
+		parent := f[parent_id]
 		parent_id = parent.Parent
 		path = parent.Title.String + "/" + path
 	}
 	return path
 }
+
+// Fingerprint summarizes moz_bookmarks and moz_keywords, which change with
+// every bookmark edit but not with browsing history. places.sqlite is read
+// in place for this; if that fails, e.g. because Firefox holds a lock, the
+// modification time and size of the database are used.
+func (fp *FirefoxPlugin) Fingerprint() (string, error) {
+	firefoxConfig, ok := fp.GetConfig().(*FirefoxConfig)
+	if !ok {
+		return "", fmt.Errorf("configuration is not of type *FirefoxConfig")
+	}
+	if err := firefoxConfig.Load(); err != nil {
+		return "", err
+	}
+
+	placesPath := firefoxConfig.ProfilePath + "/places.sqlite"
+	summary, err := bookmarksSummary(placesPath)
+	if err == nil {
+		return placesPath + "|bookmarks:" + summary, nil
+	}
+	logger.GetLogger().Debug("Could not read places.sqlite in place", "path", placesPath, "error", err)
+
+	fingerprint := placesPath + "|stat"
+	for _, path := range []string{placesPath, placesPath + "-wal"} {
+		info, err := os.Stat(path)
+		if err != nil {
+			if path == placesPath {
+				return "", err
+			}
+			continue
+		}
+		fingerprint += fmt.Sprintf(":%d:%d", info.ModTime().UnixNano(), info.Size())
+	}
+	return fingerprint, nil
+}
+
+// WatchPaths returns places.sqlite and its write-ahead log, which Firefox
+// writes to first. GetBookmarks reads the log too, so a refresh sees what
+// was written to it.
+func (fp *FirefoxPlugin) WatchPaths() ([]string, error) {
+	firefoxConfig, ok := fp.GetConfig().(*FirefoxConfig)
+	if !ok {
+		return nil, fmt.Errorf("configuration is not of type *FirefoxConfig")
+	}
+	if err := firefoxConfig.Load(); err != nil {
+		return nil, err
+	}
+
+	placesPath := firefoxConfig.ProfilePath + "/places.sqlite"
+	return []string{placesPath, placesPath + "-wal"}, nil
+}
+
+// bookmarksSummary opens places.sqlite read-only and returns the number
+// and last modification of bookmarks and the number of keywords
+func bookmarksSummary(placesPath string) (string, error) {
+	sqlDB, err := openInPlace(placesPath)
+	if err != nil {
+		return "", err
+	}
+	defer sqlDB.Close()
+
+	var count, lastModified, maxID, keywords int64
+	err = sqlDB.QueryRow(`SELECT count(*), coalesce(max(lastModified), 0), coalesce(max(id), 0),
+       (SELECT count(*) FROM moz_keywords)
+FROM moz_bookmarks`).Scan(&count, &lastModified, &maxID, &keywords)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d:%d:%d", count, lastModified, maxID, keywords), nil
+}
+
+// openInPlace opens a database of the profile read-only without copying it
+func openInPlace(path string) (*sql.DB, error) {
+	dsn := (&url.URL{Scheme: "file", Path: path, RawQuery: "mode=ro&_busy_timeout=100"}).String()
+	return sql.Open("sqlite3", dsn)
+}
@@ -0,0 +1,116 @@
+package firefox
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zwo-bot/marks/db"
+	"github.com/zwo-bot/marks/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.Initialize("error", "")
+	os.Exit(m.Run())
+}
+
+// testPlacesSchema is the part of the places.sqlite schema marks reads
+var testPlacesSchema = []string{
+	"CREATE TABLE moz_places (id INTEGER PRIMARY KEY, url TEXT, title TEXT, description TEXT, frecency INTEGER DEFAULT -1)",
+	"CREATE TABLE moz_bookmarks (id INTEGER PRIMARY KEY, type INTEGER, fk INTEGER, parent INTEGER, position INTEGER, title TEXT, dateAdded INTEGER, lastModified INTEGER)",
+	"CREATE TABLE moz_keywords (id INTEGER PRIMARY KEY, keyword TEXT UNIQUE, place_id INTEGER)",
+	"INSERT INTO moz_bookmarks (id, type, parent, title) VALUES (1, 2, 0, ''), (3, 2, 1, 'toolbar'), (4, 2, 1, 'tags')",
+}
+
+// addPlacesBookmark adds a bookmark to the toolbar of places.sqlite
+func addPlacesBookmark(t *testing.T, places *sql.DB, id int, title string, url string) {
+	t.Helper()
+	if _, err := places.Exec("INSERT INTO moz_places (id, url, title) VALUES (?, ?, ?)", id, url, title); err != nil {
+		t.Fatalf("adding place: %v", err)
+	}
+	_, err := places.Exec("INSERT INTO moz_bookmarks (id, type, fk, parent, title, dateAdded, lastModified) VALUES (?, 1, ?, 3, ?, ?, ?)",
+		100+id, id, title, id*1000, id*1000)
+	if err != nil {
+		t.Fatalf("adding bookmark: %v", err)
+	}
+}
+
+// TestBookmarksInWriteAheadLog checks that bookmarks Firefox hasn't
+// checkpointed into places.sqlite yet are read and cached
+func TestBookmarksInWriteAheadLog(t *testing.T) {
+	dbPath := db.Path()
+	db.SetPath(filepath.Join(t.TempDir(), "bookmarks.db"))
+	if err := db.ConnectDatabase(); err != nil {
+		t.Fatalf("ConnectDatabase: %v", err)
+	}
+	t.Cleanup(func() {
+		db.CloseDatabase()
+		db.DB = nil
+		db.SetPath(dbPath)
+	})
+
+	// Firefox keeps places.sqlite open, so the log stays in place
+	profile := t.TempDir()
+	places, err := sql.Open("sqlite3", filepath.Join(profile, "places.sqlite")+"?_journal_mode=WAL")
+	if err != nil {
+		t.Fatalf("opening places.sqlite: %v", err)
+	}
+	places.SetMaxOpenConns(1)
+	defer places.Close()
+	if _, err := places.Exec("PRAGMA wal_autocheckpoint=0"); err != nil {
+		t.Fatalf("disabling checkpoints: %v", err)
+	}
+	for _, statement := range testPlacesSchema {
+		if _, err := places.Exec(statement); err != nil {
+			t.Fatalf("creating places.sqlite: %v", err)
+		}
+	}
+	addPlacesBookmark(t, places, 1, "Checkpointed", "https://example.com/old")
+	if _, err := places.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		t.Fatalf("checkpointing: %v", err)
+	}
+
+	plugin := &FirefoxPlugin{Config: &FirefoxConfig{ProfilePath: profile}}
+	before, err := plugin.Fingerprint()
+	if err != nil {
+		t.Fatalf("Fingerprint: %v", err)
+	}
+
+	addPlacesBookmark(t, places, 2, "In the log", "https://example.com/new")
+	if info, err := os.Stat(filepath.Join(profile, "places.sqlite-wal")); err != nil || info.Size() == 0 {
+		t.Fatalf("the new bookmark isn't in the write-ahead log: %v", err)
+	}
+
+	fingerprint, err := plugin.Fingerprint()
+	if err != nil {
+		t.Fatalf("Fingerprint: %v", err)
+	}
+	if fingerprint == before {
+		t.Fatal("the fingerprint doesn't see the write-ahead log")
+	}
+	bms, err := plugin.GetBookmarks(context.Background())
+	if err != nil {
+		t.Fatalf("GetBookmarks: %v", err)
+	}
+	if _, err := db.UpdateSourceBookmarks(plugin.GetName(), fingerprint, bms); err != nil {
+		t.Fatalf("UpdateSourceBookmarks: %v", err)
+	}
+
+	cached, err := db.GetBookmarks()
+	if err != nil {
+		t.Fatalf("GetBookmarks: %v", err)
+	}
+	found := make(map[string]string)
+	for _, bm := range cached {
+		found[bm.Title] = bm.Path
+	}
+	for _, title := range []string{"Checkpointed", "In the log"} {
+		if path, ok := found[title]; !ok {
+			t.Errorf("%q is not cached, got %v", title, found)
+		} else if path != "toolbar/" {
+			t.Errorf("%q is cached in folder %q, want toolbar/", title, path)
+		}
+	}
+}
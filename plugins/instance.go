@@ -0,0 +1,266 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zwo-bot/marks/bookmark"
+	"github.com/zwo-bot/marks/internal/config"
+	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/plugins/external"
+	"github.com/zwo-bot/marks/plugins/interfaces"
+	reg "github.com/zwo-bot/marks/plugins/registry"
+)
+
+// Instance is a configured plugin. There can be several instances of a
+// plugin type, e.g. for two Firefox profiles; each reports its bookmarks
+// under its own source.
+type Instance struct {
+	interfaces.Plugin
+	// Name is the key of the instance in the plugins configuration
+	Name string
+	// Type is the registered plugin the instance runs
+	Type string
+	// Priority orders the instances, highest first
+	Priority int
+	source   string
+}
+
+// InstanceConfig is an entry of the plugins configuration. The other keys
+// of the entry are the settings of the plugin itself.
+type InstanceConfig struct {
+	// Type is the registered plugin, by default the name of the entry
+	Type string
+	// Source labels the bookmarks, by default the plugin's name for an
+	// entry named after its type and the name of the entry otherwise
+	Source string
+	// Enabled is false to skip the instance
+	Enabled bool
+	// Priority orders the instances, highest first; the default is 0
+	Priority int
+	// Settings are passed to the plugin
+	Settings map[string]interface{}
+}
+
+// parseInstanceConfig reads the plugins entry called name
+func parseInstanceConfig(name string, raw interface{}) (InstanceConfig, error) {
+	ic := InstanceConfig{Type: name, Enabled: true}
+	if raw == nil {
+		return ic, nil
+	}
+	entry, ok := raw.(map[string]interface{})
+	if !ok {
+		return ic, fmt.Errorf("plugin %s: configuration must be an object", name)
+	}
+
+	var err error
+	ic.Settings = make(map[string]interface{}, len(entry))
+	for key, value := range entry {
+		switch key {
+		case "type":
+			ic.Type, err = stringSetting(name, key, value)
+		case "source":
+			ic.Source, err = stringSetting(name, key, value)
+		case "enabled":
+			var ok bool
+			if ic.Enabled, ok = value.(bool); !ok {
+				err = fmt.Errorf("plugin %s: enabled must be true or false", name)
+			}
+		case "priority":
+			// JSON numbers are decoded as float64
+			number, ok := value.(float64)
+			if !ok || number != float64(int(number)) {
+				err = fmt.Errorf("plugin %s: priority must be an integer", name)
+			}
+			ic.Priority = int(number)
+		default:
+			ic.Settings[key] = value
+		}
+		if err != nil {
+			return ic, err
+		}
+	}
+	return ic, nil
+}
+
+func stringSetting(name string, key string, value interface{}) (string, error) {
+	s, ok := value.(string)
+	if !ok || s == "" {
+		return "", fmt.Errorf("plugin %s: %s must be a non-empty string", name, key)
+	}
+	return s, nil
+}
+
+// instanceConfigs returns the instances to create: the configured ones,
+// and one with the default configuration for each registered plugin type
+// that no entry uses
+func instanceConfigs(configured map[string]interface{}) (map[string]InstanceConfig, []error) {
+	instances := make(map[string]InstanceConfig)
+	used := make(map[string]bool)
+	var errs []error
+
+	for name, raw := range configured {
+		ic, err := parseInstanceConfig(name, raw)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		used[ic.Type] = true
+		instances[name] = ic
+	}
+	for _, name := range reg.ListPlugins() {
+		if _, ok := instances[name]; !ok && !used[name] {
+			instances[name] = InstanceConfig{Type: name, Enabled: true}
+		}
+	}
+	return instances, errs
+}
+
+// newInstance creates the plugin of an instance
+func newInstance(name string, ic InstanceConfig) (*Instance, error) {
+	// Plugins without settings detect their configuration
+	var settings interface{}
+	if len(ic.Settings) > 0 {
+		settings = ic.Settings
+	}
+	plugin, err := reg.Create(ic.Type, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	source := ic.Source
+	if source == "" {
+		source = name
+		if name == ic.Type {
+			source = plugin.GetName()
+		}
+	}
+	return &Instance{Plugin: plugin, Name: name, Type: ic.Type, Priority: ic.Priority, source: source}, nil
+}
+
+// DisabledSources returns the sources of the configured instances that are
+// disabled, whose cached bookmarks should be removed. The plugins aren't
+// created, so that disabled external plugins never run. cached holds the
+// sources of the cached bookmarks by plugin type, as returned by
+// db.SourcesByType.
+func DisabledSources(cached map[string][]string) []string {
+	log := logger.GetLogger()
+
+	external.Register()
+	configs, _ := instanceConfigs(config.GlobalConfig.Plugins)
+	seen := make(map[string]bool)
+	var sources []string
+	for name, ic := range configs {
+		if ic.Enabled {
+			continue
+		}
+		disabled := disabledSources(name, ic, configs, cached)
+		log.Debug("Plugin disabled", "name", name, "sources", disabled)
+		for _, source := range disabled {
+			if !seen[source] {
+				seen[source] = true
+				sources = append(sources, source)
+			}
+		}
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// disabledSources returns the sources of the disabled instance name. The
+// source of an instance named after its type defaults to the plugin's own
+// name, which only the plugin knows. It is then every cached source of the
+// type that no other instance of the type uses; bookmarks cached before
+// types were recorded count if their source is the type's name.
+func disabledSources(name string, ic InstanceConfig, configs map[string]InstanceConfig, cached map[string][]string) []string {
+	if ic.Source != "" {
+		return []string{ic.Source}
+	}
+	if name != ic.Type {
+		return []string{name}
+	}
+
+	others := make(map[string]bool)
+	for otherName, other := range configs {
+		if otherName == name || other.Type != ic.Type {
+			continue
+		}
+		if other.Source != "" {
+			others[other.Source] = true
+		} else {
+			others[otherName] = true
+		}
+	}
+	var sources []string
+	for _, source := range cached[ic.Type] {
+		if !others[source] {
+			sources = append(sources, source)
+		}
+	}
+	for _, source := range cached[""] {
+		if strings.EqualFold(source, ic.Type) && !others[source] {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// sortInstances orders instances by priority, highest first, and by name
+func sortInstances(instances []*Instance) {
+	sort.SliceStable(instances, func(i, j int) bool {
+		if instances[i].Priority != instances[j].Priority {
+			return instances[i].Priority > instances[j].Priority
+		}
+		return instances[i].Name < instances[j].Name
+	})
+}
+
+// GetName returns the source the instance's bookmarks are stored under
+func (i *Instance) GetName() string {
+	return i.source
+}
+
+// Unwrap returns the plugin the instance runs
+func (i *Instance) Unwrap() interfaces.Plugin {
+	return i.Plugin
+}
+
+func (i *Instance) GetBookmarks(ctx context.Context) (bookmark.Bookmarks, error) {
+	bookmarks, err := i.Plugin.GetBookmarks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for j := range bookmarks {
+		bookmarks[j].Source = i.source
+		bookmarks[j].Type = i.Type
+	}
+	return bookmarks, nil
+}
+
+// Fingerprint returns the plugin's fingerprint, or an empty one if it has
+// none, so that its bookmarks are always read
+func (i *Instance) Fingerprint() (string, error) {
+	if f, ok := i.Plugin.(interfaces.Fingerprinter); ok {
+		return f.Fingerprint()
+	}
+	return "", nil
+}
+
+// WatchPaths returns the plugin's files, or none if it doesn't read files
+func (i *Instance) WatchPaths() ([]string, error) {
+	if w, ok := i.Plugin.(interfaces.Watcher); ok {
+		return w.WatchPaths()
+	}
+	return nil, nil
+}
+
+// DeleteBookmark deletes bm through the plugin, if it can delete bookmarks
+func (i *Instance) DeleteBookmark(ctx context.Context, bm bookmark.Bookmark) error {
+	if d, ok := i.Plugin.(interfaces.Deleter); ok {
+		return d.DeleteBookmark(ctx, bm)
+	}
+	return fmt.Errorf("%s: deleting bookmarks: %w", i.source, errors.ErrUnsupported)
+}
@@ -0,0 +1,43 @@
+package plugins
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDisabledSources(t *testing.T) {
+	configs := map[string]InstanceConfig{
+		"firefox":      {Type: "firefox"},
+		"firefox-work": {Type: "firefox", Source: "Firefox Work"},
+		"firefox-old":  {Type: "firefox"},
+		"wiki":         {Type: "wiki"},
+		"chrome":       {Type: "chrome", Source: "Browser"},
+	}
+	cached := map[string][]string{
+		"firefox": {"Firefox", "Firefox Work", "firefox-old"},
+		"wiki":    {"Team Wiki"},
+		// Cached before types were recorded
+		"": {"Chrome", "Wiki"},
+	}
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		// Named after its type: the cached sources no other instance uses
+		{"firefox", []string{"Firefox"}},
+		{"wiki", []string{"Team Wiki", "Wiki"}},
+		// Other instances are named by their source or name
+		{"firefox-work", []string{"Firefox Work"}},
+		{"firefox-old", []string{"firefox-old"}},
+		{"chrome", []string{"Browser"}},
+	}
+	for _, tt := range tests {
+		got := disabledSources(tt.name, configs[tt.name], configs, cached)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("disabledSources(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package interfaces
 
 import (
+	"context"
+	"os"
+
 	"github.com/zwo-bot/marks/bookmark"
 )
 
@@ -11,7 +14,73 @@ type PluginConfig interface {
 
 type Plugin interface {
 	GetName() string
-	GetBookmarks() bookmark.Bookmarks
+	// GetBookmarks reads the plugin's bookmarks. It returns an error rather
+	// than no bookmarks if they could not be read, and stops when ctx is
+	// done.
+	GetBookmarks(ctx context.Context) (bookmark.Bookmarks, error)
 	GetConfig() PluginConfig
 	SetConfig(PluginConfig)
 }
+
+// Fingerprinter is implemented by plugins that can cheaply tell whether
+// their bookmarks changed. Update skips plugins whose fingerprint is the
+// same as at the last update.
+type Fingerprinter interface {
+	// Fingerprint identifies the current state of the plugin's bookmarks.
+	// It includes the profile, so that a different profile is read again.
+	Fingerprint() (string, error)
+}
+
+// Watcher is implemented by plugins that read their bookmarks from files.
+// The daemon refreshes a plugin's bookmarks when one of its files changes.
+type Watcher interface {
+	// WatchPaths returns the files the bookmarks are read from. They need
+	// not exist, but their directories should.
+	WatchPaths() ([]string, error)
+}
+
+// Deleter is implemented by plugins that can delete bookmarks at their
+// source. DeleteBookmark fails with errors.ErrUnsupported if the plugin
+// turns out not to support it.
+type Deleter interface {
+	DeleteBookmark(ctx context.Context, bm bookmark.Bookmark) error
+}
+
+// Diagnoser is implemented by plugins that can describe where they read
+// bookmarks from, for marks doctor
+type Diagnoser interface {
+	Diagnose(ctx context.Context) Diagnosis
+}
+
+// Diagnosis describes how a plugin finds its bookmarks
+type Diagnosis struct {
+	// Profile is the detected profile, empty if none was found
+	Profile string `json:"profile"`
+	// Files are the files the plugin reads
+	Files []FileStatus `json:"files"`
+	// Schema describes the format of the files, e.g. their version
+	Schema string `json:"schema,omitempty"`
+	// Favicons is the number of favicons the browser has, -1 if unknown
+	Favicons int `json:"favicons"`
+	// Problems keep the plugin from reading bookmarks
+	Problems []string `json:"problems,omitempty"`
+	// Warnings may cause missing bookmarks or icons
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// FileStatus tells whether a file can be read
+type FileStatus struct {
+	Path     string `json:"path"`
+	Readable bool   `json:"readable"`
+	Error    string `json:"error,omitempty"`
+}
+
+// CheckFile returns whether path can be opened for reading
+func CheckFile(path string) FileStatus {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileStatus{Path: path, Error: err.Error()}
+	}
+	f.Close()
+	return FileStatus{Path: path, Readable: true}
+}
@@ -1,9 +1,16 @@
 package plugins
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/zwo-bot/marks/bookmark"
 	"github.com/zwo-bot/marks/internal/config"
 	"github.com/zwo-bot/marks/internal/logger"
+	"github.com/zwo-bot/marks/plugins/external"
 	"github.com/zwo-bot/marks/plugins/interfaces"
 	reg "github.com/zwo-bot/marks/plugins/registry"
 
@@ -14,66 +21,145 @@ import (
 
 type Plugins []interfaces.Plugin
 
-// Init initializes all plugins
+// Init creates the configured plugin instances, and an instance with the
+// default configuration of each registered plugin that none is configured
+// for, ordered by priority. Instances that can't be created are logged and
+// left out.
 func Init() Plugins {
 	log := logger.GetLogger()
 	log.Info("Initializing plugins")
+
+	plugins, errs := Setup()
+	for _, err := range errs {
+		log.Error("Plugin not loaded", "error", err)
+	}
+	return plugins
+}
+
+// Setup creates the plugins like Init and returns why instances were left
+// out
+func Setup() (Plugins, []error) {
+	log := logger.GetLogger()
 	log.Debug("Starting plugin initialization")
-	plugins := Plugins{}
 
+	external.Register()
 	registered := reg.ListPlugins()
 	log.Debug("Found registered plugins", "count", len(registered), "plugins", registered)
 
-	// Initialize registered plugins
-	for _, name := range registered {
-		log.Debug("Initializing plugin", "name", name)
-		
-		// Get plugin config if available
-		var pluginConfig interface{}
-		if cfg, ok := config.GlobalConfig.Plugins[name]; ok {
-			pluginConfig = cfg
-		}
+	configs, errs := instanceConfigs(config.GlobalConfig.Plugins)
 
-		// Create plugin instance
-		plugin, err := reg.Create(name, pluginConfig)
+	var instances []*Instance
+	for name, ic := range configs {
+		if !ic.Enabled {
+			log.Info("Plugin disabled", "name", name)
+			continue
+		}
+		log.Debug("Initializing plugin", "name", name, "type", ic.Type)
+		instance, err := newInstance(name, ic)
 		if err != nil {
-			log.Error("Failed to initialize plugin", "name", name, "error", err)
+			errs = append(errs, fmt.Errorf("plugin %s: %w", name, err))
 			continue
 		}
+		instances = append(instances, instance)
+	}
+	sortInstances(instances)
 
-		plugins = append(plugins, plugin)
-		log.Info("Added plugin", "name", name)
+	// Instances sharing a source would overwrite each other's bookmarks
+	plugins := Plugins{}
+	sources := make(map[string]string)
+	for _, instance := range instances {
+		if other, ok := sources[instance.GetName()]; ok {
+			errs = append(errs, fmt.Errorf("plugin %s: plugin %s has the same source %q, set a different source for one",
+				instance.Name, other, instance.GetName()))
+			continue
+		}
+		sources[instance.GetName()] = instance.Name
+		plugins = append(plugins, instance)
+		log.Info("Added plugin", "name", instance.Name, "source", instance.GetName())
 	}
 
-	return plugins
+	return plugins, errs
 }
 
-func (p Plugins) GetBookmarks() bookmark.Bookmarks {
-	log := logger.GetLogger()
-	var bookmarks bookmark.Bookmarks
+// DefaultTimeout is how long a plugin may take to read its bookmarks
+const DefaultTimeout = 30 * time.Second
 
-	for _, plugin := range p {
-		name := plugin.GetName()
-		log.Info("Getting bookmarks from plugin", "plugin", name)
-		pluginBookmarks := plugin.GetBookmarks()
-		log.Debug("Got bookmarks from plugin", "plugin", name, "count", len(pluginBookmarks))
-		bookmarks = append(bookmarks, pluginBookmarks...)
+// Result is the outcome of reading the bookmarks of one plugin
+type Result struct {
+	Plugin    interfaces.Plugin
+	Bookmarks bookmark.Bookmarks
+	// Err is set if the bookmarks could not be read; Bookmarks is nil then
+	Err      error
+	Duration time.Duration
+}
+
+// Fetch reads the bookmarks of all plugins concurrently and returns a
+// result per plugin, in the order of the plugins. Each plugin gets at most
+// timeout; a plugin that takes longer or is still running when ctx is done
+// fails with the context's error.
+func (p Plugins) Fetch(ctx context.Context, timeout time.Duration) []Result {
+	results := make([]Result, len(p))
+	var wg sync.WaitGroup
+	for i, plugin := range p {
+		wg.Add(1)
+		go func(i int, plugin interfaces.Plugin) {
+			defer wg.Done()
+			results[i] = fetch(ctx, plugin, timeout)
+		}(i, plugin)
 	}
-	return bookmarks
+	wg.Wait()
+	return results
 }
 
-func (p Plugins) GetBookmarksByPlugin(pluginName string) bookmark.Bookmarks {
-	log := logger.GetLogger()
+// fetch reads the bookmarks of one plugin. A plugin that does not stop
+// when its context is done is abandoned; its goroutine ends with the
+// process.
+func fetch(ctx context.Context, plugin interfaces.Plugin, timeout time.Duration) Result {
+	log := logger.GetLogger().With("plugin", plugin.GetName())
+	log.Info("Getting bookmarks from plugin")
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan Result, 1)
+	go func() {
+		bookmarks, err := plugin.GetBookmarks(ctx)
+		done <- Result{Plugin: plugin, Bookmarks: bookmarks, Err: err}
+	}()
+
+	var result Result
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result = Result{Plugin: plugin, Err: ctx.Err()}
+	}
+	result.Duration = time.Since(start)
+
+	if result.Err != nil {
+		result.Bookmarks = nil
+		log.Error("Could not get bookmarks from plugin", "error", result.Err, "duration", result.Duration)
+	} else {
+		log.Debug("Got bookmarks from plugin", "count", len(result.Bookmarks), "duration", result.Duration)
+	}
+	return result
+}
+
+// GetBookmarks reads the bookmarks of all plugins. The error joins the
+// errors of the plugins that failed; the bookmarks of the others are
+// returned anyway.
+func (p Plugins) GetBookmarks(ctx context.Context) (bookmark.Bookmarks, error) {
 	var bookmarks bookmark.Bookmarks
+	var errs []error
 
-	for _, plugin := range p {
-		if plugin.GetName() == pluginName {
-			log.With("plugin", plugin.GetName())
-			log.Info("Getting bookmarks")
-			bookmarks = append(bookmarks, plugin.GetBookmarks()...)
+	for _, result := range p.Fetch(ctx, DefaultTimeout) {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", result.Plugin.GetName(), result.Err))
+			continue
 		}
+		bookmarks = append(bookmarks, result.Bookmarks...)
 	}
-	return bookmarks
+	return bookmarks, errors.Join(errs...)
 }
 
 func (p Plugins) ListPlugins() []string {
@@ -2,6 +2,8 @@ package registry
 
 import (
 	"fmt"
+	"sort"
+
 	"github.com/zwo-bot/marks/plugins/interfaces"
 )
 
@@ -28,11 +30,12 @@ func Create(name string, config interface{}) (interfaces.Plugin, error) {
 	return factory(config)
 }
 
-// ListPlugins returns a list of registered plugin names
+// ListPlugins returns the registered plugin names in alphabetical order
 func ListPlugins() []string {
 	names := make([]string, 0, len(registry))
 	for name := range registry {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 	return names
 }